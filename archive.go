@@ -0,0 +1,232 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultMaxArchiveEntries = 1000
+	defaultMaxArchiveBytes   = 1 << 30
+)
+
+// maxArchiveEntries and maxArchiveBytes, from MAX_ARCHIVE_ENTRIES and
+// MAX_ARCHIVE_BYTES, bound what one archive may extract to, so a small zip
+// bomb can't fill the disk. They count what is actually extracted, not the
+// sizes the archive claims.
+var (
+	maxArchiveEntries = defaultMaxArchiveEntries
+	maxArchiveBytes   = int64(defaultMaxArchiveBytes)
+)
+
+var (
+	errArchiveTooLarge = errors.New("archive is too large")
+	errInvalidArchive  = errors.New("invalid archive")
+)
+
+// archiveFormat returns "zip", "tar" or "tar.gz" for an archive filename,
+// with the name stripped of its extension.
+func archiveFormat(filename string) (format, base string, ok bool) {
+	lower := strings.ToLower(filename)
+	for _, f := range []struct{ ext, format string }{
+		{".tar.gz", "tar.gz"},
+		{".tgz", "tar.gz"},
+		{".tar", "tar"},
+		{".zip", "zip"},
+	} {
+		if strings.HasSuffix(lower, f.ext) {
+			return f.format, filename[:len(filename)-len(f.ext)], true
+		}
+	}
+	return "", "", false
+}
+
+// archiveUploadHandler extracts an uploaded .zip, .tar or .tar.gz archive,
+// sent with extract=true, and pins its files as one directory named after
+// the archive (or by dir_name), as /upload-dir would.
+func archiveUploadHandler(c *fiber.Ctx, fileHeader *multipart.FileHeader, opts uploadOptions) error {
+	format, base, ok := archiveFormat(fileHeader.Filename)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "extract=true needs a .zip, .tar, .tar.gz or .tgz file"})
+	}
+	if base == "" {
+		base = "upload"
+	}
+	dirName, err := dirNameFromForm(c, base)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "File open failed"})
+	}
+	defer file.Close()
+
+	root, err := os.MkdirTemp(spoolDir, "ipfs-archive-*")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer os.RemoveAll(root)
+
+	files, err := extractArchive(file, fileHeader.Size, format, root)
+	switch {
+	case errors.Is(err, errArchiveTooLarge):
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": err.Error(), "pinned": 0})
+	case errors.Is(err, errInvalidArchive):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return pinDirResponse(c, dirName, files, opts)
+}
+
+// extractArchive writes the regular files of the archive in file to root
+// and returns them as a directory upload. Entries that would land outside
+// root, links and other special files are rejected.
+func extractArchive(file multipart.File, size int64, format, root string) ([]dirUploadFile, error) {
+	x := &archiveExtractor{root: root, seen: map[string]bool{}}
+	var err error
+	if format == "zip" {
+		err = x.extractZip(file, size)
+	} else {
+		err = x.extractTar(file, format == "tar.gz")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(x.files) == 0 {
+		return nil, fmt.Errorf("%w: it contains no files", errInvalidArchive)
+	}
+	return x.files, nil
+}
+
+type archiveExtractor struct {
+	root    string
+	entries int
+	total   int64
+	seen    map[string]bool
+	files   []dirUploadFile
+}
+
+func (x *archiveExtractor) extractZip(file multipart.File, size int64) error {
+	zr, err := zip.NewReader(file, size)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errInvalidArchive, err)
+	}
+	for _, f := range zr.File {
+		if err := x.count(); err != nil {
+			return err
+		}
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if !f.Mode().IsRegular() {
+			return fmt.Errorf("%w: %q is not a regular file", errInvalidArchive, f.Name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", errInvalidArchive, f.Name, err)
+		}
+		err = x.add(f.Name, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *archiveExtractor) extractTar(file multipart.File, gzipped bool) error {
+	var r io.Reader = file
+	if gzipped {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errInvalidArchive, err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", errInvalidArchive, err)
+		}
+		if err := x.count(); err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir, tar.TypeXGlobalHeader:
+			continue
+		case tar.TypeReg:
+		default:
+			return fmt.Errorf("%w: %q is not a regular file", errInvalidArchive, hdr.Name)
+		}
+		if err := x.add(hdr.Name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// count enforces maxArchiveEntries over every entry, directories included.
+func (x *archiveExtractor) count() error {
+	x.entries++
+	if x.entries > maxArchiveEntries {
+		return fmt.Errorf("%w: it has more than %d entries", errArchiveTooLarge, maxArchiveEntries)
+	}
+	return nil
+}
+
+// add extracts one file, stopping as soon as the running total passes
+// maxArchiveBytes.
+func (x *archiveExtractor) add(name string, r io.Reader) error {
+	rel, err := cleanRelativePath(name)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errInvalidArchive, err)
+	}
+	if x.seen[rel] {
+		return fmt.Errorf("%w: duplicate path %q", errInvalidArchive, rel)
+	}
+	x.seen[rel] = true
+
+	dst := filepath.Join(x.root, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(dst), 0o700); err != nil {
+		return fmt.Errorf("%w: %s: %v", errInvalidArchive, rel, err)
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", errInvalidArchive, rel, err)
+	}
+	remaining := maxArchiveBytes - x.total
+	n, err := io.Copy(out, io.LimitReader(r, remaining+1))
+	out.Close()
+	if n > remaining {
+		return fmt.Errorf("%w: it extracts to more than %d bytes", errArchiveTooLarge, maxArchiveBytes)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", errInvalidArchive, rel, err)
+	}
+	x.total += n
+
+	x.files = append(x.files, dirUploadFile{
+		path: rel,
+		size: n,
+		open: func() (multipart.File, error) { return os.Open(dst) },
+	})
+	return nil
+}
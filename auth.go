@@ -0,0 +1,28 @@
+package main
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// apiToken, from API_TOKEN, is the bearer token upload and pin management
+// requests must present. Empty leaves the endpoints open.
+var apiToken string
+
+// requireAPIToken rejects requests without a matching Authorization header
+// when apiToken is set.
+func requireAPIToken(c *fiber.Ctx) error {
+	if apiToken == "" {
+		return c.Next()
+	}
+
+	header := c.Get(fiber.HeaderAuthorization)
+	token := strings.TrimPrefix(header, "Bearer ")
+	if token == header || subtle.ConstantTimeCompare([]byte(token), []byte(apiToken)) != 1 {
+		c.Set(fiber.HeaderWWWAuthenticate, "Bearer")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "missing or invalid API token"})
+	}
+	return c.Next()
+}
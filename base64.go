@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"mime"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// bytesFile adapts an in-memory upload to multipart.File.
+type bytesFile struct {
+	*bytes.Reader
+}
+
+func (bytesFile) Close() error { return nil }
+
+// parseDataURI splits an optional "data:<type>;base64," prefix off data and
+// returns the declared media type along with the base64 payload.
+func parseDataURI(data string) (string, string, error) {
+	if !strings.HasPrefix(data, "data:") {
+		return "", data, nil
+	}
+	header, payload, ok := strings.Cut(data[len("data:"):], ",")
+	if !ok || !strings.HasSuffix(header, ";base64") {
+		return "", "", errors.New("data URI must be base64 encoded")
+	}
+	mediaType := strings.TrimSuffix(header, ";base64")
+	if i := strings.IndexByte(mediaType, ';'); i >= 0 {
+		mediaType = mediaType[:i]
+	}
+	return strings.ToLower(mediaType), payload, nil
+}
+
+// uploadBase64Handler pins the bytes of a base64 string or data URI. When
+// no filename is given, one is derived from the data URI's media type. The
+// stored content is still sniffed against ALLOWED_MIME_TYPES rather than
+// trusting the declared type.
+func uploadBase64Handler(c *fiber.Ctx) error {
+	var req struct {
+		Data     string `json:"data"`
+		Filename string `json:"filename"`
+	}
+	// Leave room for base64's 4/3 expansion and the rest of the object.
+	if err := decodeJSONBody(c, &req, int(maxUploadBytes/3*4)+maxJSONRequestBytes); err != nil {
+		return jsonBodyErrorResponse(c, err)
+	}
+	if req.Data == "" {
+		return jsonBodyErrorResponse(c, &requestFieldError{field: "data", msg: `is required, e.g. {"data":"data:image/png;base64,...","filename":"x.png"}`})
+	}
+
+	opts, err := uploadOptionsFromRequest(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	mediaType, payload, err := parseDataURI(req.Data)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Reject oversized payloads before allocating the decoded buffer.
+	if int64(base64.StdEncoding.DecodedLen(len(payload))) > maxUploadBytes+2 {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fileTooLargeError())
+	}
+	content, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid base64 data"})
+	}
+	if int64(len(content)) > maxUploadBytes {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fileTooLargeError())
+	}
+
+	filename := req.Filename
+	if filename == "" {
+		filename = "upload"
+		if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+			filename += exts[0]
+		}
+	}
+
+	file := bytesFile{bytes.NewReader(content)}
+	contentType, err := checkContentType(file)
+	if err != nil {
+		return contentTypeErrorResponse(c, err)
+	}
+	if mediaType != "" {
+		contentType = mediaType
+	}
+
+	fileHeader := newFileHeader(filename, int64(len(content)), contentType)
+	result, err := uploadToIPFS(uploadContext(c), file, fileHeader, opts)
+	if err != nil {
+		return pinErrorResponse(c, fiber.StatusInternalServerError, err)
+	}
+
+	return c.JSON(result)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+const defaultBatchConcurrency = 4
+
+// batchEntry is one manifest row written by `cli --batch`.
+type batchEntry struct {
+	Path   string `json:"path"`
+	CID    string `json:"cid,omitempty"`
+	URL    string `json:"url,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// cliUploadBatch uploads every path listed in opts.batch, one per line, with
+// up to opts.concurrency uploads in flight. The manifest goes to stdout as
+// CSV, or JSON with --json, in the order of the list; failed files carry
+// their error. It reports how many uploads failed.
+func cliUploadBatch(opts cliOptions) (int, error) {
+	paths, err := readBatchList(opts.batch)
+	if err != nil {
+		return 0, err
+	}
+	if opts.concurrency < 1 {
+		return 0, errors.New("--concurrency must be at least 1")
+	}
+
+	entries := make([]batchEntry, len(paths))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < opts.concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				entries[i] = uploadBatchEntry(paths[i], opts)
+			}
+		}()
+	}
+	for i := range paths {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	failed := 0
+	for _, e := range entries {
+		if e.Error != "" {
+			failed++
+		}
+	}
+
+	if opts.json {
+		printJSON(entries)
+	} else if err := writeBatchCSV(entries); err != nil {
+		return failed, err
+	}
+	fmt.Fprintf(os.Stderr, "Batch finished: %d uploaded, %d failed\n", len(entries)-failed, failed)
+	return failed, nil
+}
+
+func uploadBatchEntry(path string, opts cliOptions) batchEntry {
+	entry := batchEntry{Path: path}
+	result, err := uploadFile(path, opts)
+	if err != nil {
+		entry.Error = err.Error()
+		return entry
+	}
+	entry.CID, entry.URL, entry.SHA256 = result.CID, result.IpfsURL, result.SHA256
+	return entry
+}
+
+// readBatchList reads the non-blank lines of path, skipping # comments.
+func readBatchList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var paths []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		paths = append(paths, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no files listed in %s", path)
+	}
+	return paths, nil
+}
+
+func writeBatchCSV(entries []batchEntry) error {
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"path", "cid", "url", "sha256", "error"})
+	for _, e := range entries {
+		w.Write([]string{e.Path, e.CID, e.URL, e.SHA256, e.Error})
+	}
+	w.Flush()
+	return w.Error()
+}
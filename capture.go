@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// captureLocalsKey holds the capturedRequest of the request being served.
+// Like the request ID it can be read back from the context handed to
+// Pinata calls.
+const captureLocalsKey = "debugCapture"
+
+// debugCaptureDir, from DEBUG_CAPTURE_DIR, receives a JSON file per Pinata
+// call holding the upload request that caused it and Pinata's response,
+// with credentials redacted.
+var debugCaptureDir string
+
+var captureSeq uint64
+
+// capturedRequest is what a capture file records about the client request.
+type capturedRequest struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Query   map[string]string `json:"query,omitempty"`
+	IP      string            `json:"ip"`
+	Headers map[string]string `json:"headers"`
+	Form    map[string]string `json:"form,omitempty"`
+	Files   []capturedFile    `json:"files,omitempty"`
+}
+
+type capturedFile struct {
+	Field    string `json:"field"`
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+}
+
+// captureRequests records each request's metadata for captureExchange when
+// DEBUG_CAPTURE_DIR is set.
+func captureRequests(c *fiber.Ctx) error {
+	if debugCaptureDir == "" {
+		return c.Next()
+	}
+
+	req := &capturedRequest{
+		Method:  c.Method(),
+		Path:    c.Path(),
+		IP:      c.IP(),
+		Headers: map[string]string{},
+	}
+	c.Request().Header.VisitAll(func(k, v []byte) {
+		req.Headers[string(k)] = redactedValue(string(k), string(v))
+	})
+	if q := c.Queries(); len(q) > 0 {
+		req.Query = map[string]string{}
+		for k, v := range q {
+			req.Query[k] = redactedValue(k, v)
+		}
+	}
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+		if form, err := c.MultipartForm(); err == nil {
+			req.Form = map[string]string{}
+			for k, v := range form.Value {
+				req.Form[k] = redactedValue(k, strings.Join(v, ", "))
+			}
+			for field, headers := range form.File {
+				for _, fh := range headers {
+					req.Files = append(req.Files, capturedFile{Field: field, Filename: fh.Filename, Size: fh.Size})
+				}
+			}
+		}
+	}
+	c.Locals(captureLocalsKey, req)
+	return c.Next()
+}
+
+// captureExchange writes one Pinata call, described by the trace fields, to
+// a timestamped file in the background. Capturing is best effort: failures
+// are logged and never reach the upload.
+func captureExchange(ctx context.Context, pinataCall map[string]interface{}) {
+	now := time.Now().UTC()
+	record := map[string]interface{}{
+		"time":       now.Format(time.RFC3339Nano),
+		"request_id": requestIDFromContext(ctx),
+		"pinata":     pinataCall,
+	}
+	if req, ok := ctx.Value(captureLocalsKey).(*capturedRequest); ok {
+		record["request"] = req
+	}
+	name := fmt.Sprintf("%s-%06d.json", now.Format("20060102T150405.000000000Z"), atomic.AddUint64(&captureSeq, 1))
+
+	go func() {
+		b, err := json.MarshalIndent(record, "", "  ")
+		if err == nil {
+			err = os.WriteFile(filepath.Join(debugCaptureDir, name), b, 0o600)
+		}
+		if err != nil {
+			logEvent("warn", "debug capture failed", map[string]interface{}{"file": name, "error": err.Error()})
+		}
+	}()
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+var (
+	// CIDv0: base58btc-encoded sha2-256 multihash, always 46 chars with "Qm".
+	cidV0Pattern = regexp.MustCompile(`^Qm[1-9A-HJ-NP-Za-km-z]{44}$`)
+	// CIDv1 in the default base32 multibase ("b" prefix).
+	cidV1Pattern = regexp.MustCompile(`^b[a-z2-7]{50,}$`)
+)
+
+// isValidCID is a cheap syntactic check used to reject obviously bad input
+// before it reaches an upstream API.
+func isValidCID(cid string) bool {
+	return cidV0Pattern.MatchString(cid) || cidV1Pattern.MatchString(cid)
+}
+
+// verifyLocalCID recomputes the CID of file and compares it with the hash
+// Pinata reported, catching content mangled on the way to Pinata.
+func verifyLocalCID(file io.ReadSeeker, remoteCID string) error {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	localCID, err := computeCIDVersion(file, cidVersionOf(remoteCID))
+	if err != nil {
+		return err
+	}
+	if localCID != remoteCID {
+		return fmt.Errorf("cid mismatch: computed %s locally but pinata returned %s", localCID, remoteCID)
+	}
+	return nil
+}
+
+// cidVersionOf tells a CIDv0 ("Qm...") from a CIDv1 by its prefix.
+func cidVersionOf(cid string) int {
+	if strings.HasPrefix(cid, "Qm") {
+		return 0
+	}
+	return 1
+}
+
+// These mirror the `ipfs add` defaults Pinata uses: 256KiB fixed-size
+// chunks laid out in a balanced DAG of at most 174 links per node.
+const (
+	cidChunkSize    = 256 * 1024
+	cidMaxLinks     = 174
+	codecDagPB      = 0x70
+	codecRaw        = 0x55
+	multihashSHA256 = 0x12
+)
+
+// dagLink is a reference from a parent node to an already-built child.
+type dagLink struct {
+	cid      []byte // binary CID
+	tsize    uint64 // size of the serialized child DAG
+	fileSize uint64 // bytes of file content under the child
+}
+
+// computeCID returns the CIDv0 that `ipfs add` (and Pinata's default pin)
+// would assign to the content of r.
+func computeCID(r io.Reader) (string, error) {
+	return computeCIDVersion(r, 0)
+}
+
+// computeCIDVersion computes the CID of r as a UnixFS file. Version 1 uses
+// raw leaves and base32, matching Pinata's cidVersion=1 behaviour.
+func computeCIDVersion(r io.Reader, version int) (string, error) {
+	if version != 0 && version != 1 {
+		return "", errors.New("cid version must be 0 or 1")
+	}
+	rawLeaves := version == 1
+
+	// levels[0] holds leaves, levels[n] holds nodes whose children are at
+	// level n-1. A level is folded into its parent as soon as it is full.
+	var levels [][]dagLink
+	push := func(level int, link dagLink) {
+		for len(levels) <= level {
+			levels = append(levels, nil)
+		}
+		levels[level] = append(levels[level], link)
+	}
+
+	buf := make([]byte, cidChunkSize)
+	leaves := 0
+	for {
+		n, err := io.ReadFull(r, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return "", err
+		}
+		push(0, buildLeaf(buf[:n], version, rawLeaves))
+		leaves++
+
+		for level := 0; len(levels[level]) == cidMaxLinks; level++ {
+			push(level+1, buildParent(levels[level], version))
+			levels[level] = nil
+		}
+
+		if err == io.ErrUnexpectedEOF {
+			break
+		}
+	}
+
+	if leaves == 0 {
+		// An empty file is a single leaf with no content.
+		return encodeCID(buildLeaf(nil, version, rawLeaves).cid, version), nil
+	}
+
+	// Fold partial levels upward until a single root remains.
+	for level := 0; ; level++ {
+		top := true
+		for _, higher := range levels[level+1:] {
+			if len(higher) > 0 {
+				top = false
+				break
+			}
+		}
+		if top && len(levels[level]) == 1 {
+			return encodeCID(levels[level][0].cid, version), nil
+		}
+		if len(levels[level]) > 0 {
+			push(level+1, buildParent(levels[level], version))
+			levels[level] = nil
+		}
+	}
+}
+
+func buildLeaf(chunk []byte, version int, rawLeaves bool) dagLink {
+	if rawLeaves {
+		return dagLink{
+			cid:      binaryCID(codecRaw, chunk, version),
+			tsize:    uint64(len(chunk)),
+			fileSize: uint64(len(chunk)),
+		}
+	}
+
+	size := uint64(len(chunk))
+	data := unixfsFileData(chunk, &size, nil)
+	node := encodePBNode(nil, data)
+	return dagLink{
+		cid:      binaryCID(codecDagPB, node, version),
+		tsize:    uint64(len(node)),
+		fileSize: size,
+	}
+}
+
+func buildParent(children []dagLink, version int) dagLink {
+	var fileSize, tsize uint64
+	blockSizes := make([]uint64, len(children))
+	for i, child := range children {
+		fileSize += child.fileSize
+		tsize += child.tsize
+		blockSizes[i] = child.fileSize
+	}
+
+	data := unixfsFileData(nil, &fileSize, blockSizes)
+	node := encodePBNode(children, data)
+	return dagLink{
+		cid:      binaryCID(codecDagPB, node, version),
+		tsize:    tsize + uint64(len(node)),
+		fileSize: fileSize,
+	}
+}
+
+// unixfsFileData encodes a UnixFS Data message of type File.
+func unixfsFileData(content []byte, fileSize *uint64, blockSizes []uint64) []byte {
+	var b []byte
+	b = appendVarintField(b, 1, 2) // Type: File
+	if content != nil {
+		b = appendBytesField(b, 2, content)
+	}
+	if fileSize != nil {
+		b = appendVarintField(b, 3, *fileSize)
+	}
+	for _, size := range blockSizes {
+		b = appendVarintField(b, 4, size)
+	}
+	return b
+}
+
+// encodePBNode encodes a dag-pb PBNode. Links are serialized before Data as
+// required by the canonical dag-pb form.
+func encodePBNode(links []dagLink, data []byte) []byte {
+	var b []byte
+	for _, link := range links {
+		var l []byte
+		l = appendBytesField(l, 1, link.cid)
+		l = appendBytesField(l, 2, nil) // Name: ""
+		l = appendVarintField(l, 3, link.tsize)
+		b = appendBytesField(b, 2, l)
+	}
+	return appendBytesField(b, 1, data)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(b, tmp[:n]...)
+}
+
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	b = appendUvarint(b, uint64(field<<3))
+	return appendUvarint(b, v)
+}
+
+func appendBytesField(b []byte, field int, v []byte) []byte {
+	b = appendUvarint(b, uint64(field<<3|2))
+	b = appendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// binaryCID hashes block and returns its CID in binary form: a bare
+// multihash for v0, or version+codec+multihash for v1.
+func binaryCID(codec uint64, block []byte, version int) []byte {
+	digest := sha256.Sum256(block)
+	mh := append([]byte{multihashSHA256, sha256.Size}, digest[:]...)
+	if version == 0 {
+		return mh
+	}
+	b := appendUvarint(nil, 1)
+	b = appendUvarint(b, codec)
+	return append(b, mh...)
+}
+
+func encodeCID(cid []byte, version int) string {
+	if version == 0 {
+		return base58Encode(cid)
+	}
+	enc := base32.StdEncoding.WithPadding(base32.NoPadding)
+	return "b" + strings.ToLower(enc.EncodeToString(cid))
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+func base58Encode(b []byte) string {
+	n := new(big.Int).SetBytes(b)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, c := range b {
+		if c != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	clamavChunkSize   = 64 << 10
+	clamavDialTimeout = 5 * time.Second
+	clamavScanTimeout = 2 * time.Minute
+)
+
+// clamavAddress is the host:port of a clamd daemon from CLAMAV_ADDRESS.
+// When set, every upload is scanned before it is pinned.
+var clamavAddress string
+
+// infectedFileError is a clamd verdict that the upload carries malware.
+type infectedFileError struct {
+	signature string
+}
+
+func (e *infectedFileError) Error() string {
+	return fmt.Sprintf("file rejected by virus scan: %s found", e.signature)
+}
+
+// scanForViruses streams r to clamd with the INSTREAM command, chunk by
+// chunk, so the upload is never held in memory. It returns an
+// *infectedFileError when clamd reports a signature.
+func scanForViruses(ctx context.Context, r io.Reader) error {
+	dialer := net.Dialer{Timeout: clamavDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", clamavAddress)
+	if err != nil {
+		return fmt.Errorf("virus scan failed: %w", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(clamavScanTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	if err := streamToClamd(conn, r); err != nil {
+		return fmt.Errorf("virus scan failed: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil {
+		return fmt.Errorf("virus scan failed: reading clamd reply: %w", err)
+	}
+	return parseClamdReply(strings.TrimSuffix(reply, "\x00"))
+}
+
+// streamToClamd sends the INSTREAM command, r as length-prefixed chunks
+// and the zero-length chunk that ends the stream.
+func streamToClamd(w io.Writer, r io.Reader) error {
+	if _, err := io.WriteString(w, "zINSTREAM\x00"); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 4+clamavChunkSize)
+	for {
+		n, err := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, werr := w.Write(buf[:4+n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := w.Write([]byte{0, 0, 0, 0})
+	return err
+}
+
+// parseClamdReply interprets replies like "stream: OK",
+// "stream: Eicar-Signature FOUND" and "INSTREAM size limit exceeded. ERROR".
+func parseClamdReply(reply string) error {
+	reply = strings.TrimSpace(reply)
+	switch {
+	case strings.HasSuffix(reply, " FOUND"):
+		sig := strings.TrimSuffix(reply, " FOUND")
+		if i := strings.IndexByte(sig, ':'); i >= 0 {
+			sig = strings.TrimSpace(sig[i+1:])
+		}
+		return &infectedFileError{signature: sig}
+	case strings.HasSuffix(reply, " OK"):
+		return nil
+	default:
+		return fmt.Errorf("virus scan failed: clamd replied %q", reply)
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type cliOptions struct {
+	file    string
+	url     string
+	name    string
+	dir     string
+	ignore  string
+	wrap    bool
+	dryRun  bool
+	json    bool
+	stdin   bool
+	group   string
+	private bool
+	// progress draws an upload progress bar on stderr; set by cliUpload,
+	// not a flag.
+	progress bool
+
+	batch       string
+	concurrency int
+}
+
+func parseCLIFlags(args []string) cliOptions {
+	var opts cliOptions
+	flags := flag.NewFlagSet("cli", flag.ExitOnError)
+	flags.StringVar(&opts.file, "file", "", "upload this file, print the result as JSON and exit")
+	flags.BoolVar(&opts.stdin, "stdin", false, "upload standard input as --name, print the result as JSON and exit")
+	flags.StringVar(&opts.url, "url", "", "have the server fetch and pin this URL, print the result as JSON and exit")
+	flags.StringVar(&opts.name, "name", "", "Pinata metadata name for uploads (defaults to the filename)")
+	flags.StringVar(&opts.group, "group", "", "add uploads to this Pinata group ID")
+	flags.BoolVar(&opts.private, "private", false, "tag uploads visibility=private and return dedicated gateway URLs (content stays public to anyone with the CID)")
+	flags.StringVar(&opts.dir, "dir", "", "upload every file under this directory, print a path to CID mapping as JSON and exit")
+	flags.StringVar(&opts.ignore, "ignore", "", "with --dir, skip files and directories matching this glob")
+	flags.BoolVar(&opts.wrap, "wrap", false, "with --dir, pin the whole directory to Pinata as a single DAG")
+	flags.StringVar(&opts.batch, "batch", "", "upload every file listed in this file, one path per line, and print a CSV manifest (JSON with --json)")
+	flags.IntVar(&opts.concurrency, "concurrency", defaultBatchConcurrency, "with --batch, how many files to upload at once")
+	flags.BoolVar(&opts.dryRun, "dry-run", false, "compute the CIDv1 locally instead of uploading")
+	flags.BoolVar(&opts.json, "json", false, "print only pretty-printed JSON results on stdout, with prompts and errors on stderr")
+	flags.Parse(args)
+	return opts
+}
+
+// cliUpload uploads the --file, --url or --stdin input given on the command
+// line, or falls back to the interactive prompt when none was passed.
+func cliUpload(opts cliOptions) {
+	// A bar would garble --json output and concurrent batch uploads.
+	opts.progress = !opts.json && opts.batch == "" && stderrIsTerminal()
+
+	if opts.dir != "" {
+		if err := cliUploadDir(opts); err != nil {
+			fmt.Fprintln(os.Stderr, "Upload failed:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if opts.batch != "" {
+		failed, err := cliUploadBatch(opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Upload failed:", err)
+			os.Exit(1)
+		}
+		if failed > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if opts.file != "" || opts.url != "" || opts.stdin {
+		var result *uploadResult
+		var err error
+		if opts.url != "" && encryptionKey != nil {
+			err = errors.New("--url uploads are fetched by the server and cannot be encrypted")
+		} else if opts.url != "" {
+			result, err = sendURLToServer(opts.url)
+		} else if opts.stdin {
+			result, err = sendStdinToServer(os.Stdin, opts)
+		} else {
+			result, err = uploadFile(opts.file, opts)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Upload failed:", err)
+			os.Exit(1)
+		}
+		if opts.json {
+			printJSON(result)
+		} else {
+			json.NewEncoder(os.Stdout).Encode(result)
+		}
+		return
+	}
+
+	// With --json, stdout carries nothing but results.
+	diag := io.Writer(os.Stdout)
+	if opts.json {
+		diag = os.Stderr
+	}
+
+	failed := false
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Fprint(diag, "Enter the path of the image file (or 'exit' to quit): ")
+		input, err := reader.ReadString('\n')
+		input = strings.TrimSpace(input)
+		if input == "exit" || (err != nil && input == "") {
+			fmt.Fprintln(diag, "Exiting CLI uploader.")
+			break
+		}
+
+		result, err := uploadFile(input, opts)
+		if err != nil {
+			fmt.Fprintln(diag, "Upload failed:", err)
+			failed = true
+			continue
+		}
+
+		if opts.json {
+			printJSON(result)
+			continue
+		}
+		fmt.Println("CID:", result.CID)
+		fmt.Println("URL:", result.IpfsURL)
+		fmt.Println("SHA-256:", result.SHA256)
+	}
+
+	if failed && opts.json {
+		os.Exit(1)
+	}
+}
+
+func printJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// uploadFile sends path to the server, or with --dry-run only computes the
+// CID it would get.
+func uploadFile(path string, opts cliOptions) (*uploadResult, error) {
+	if !opts.dryRun {
+		return sendFileToServer(path, opts)
+	}
+	if encryptionKey != nil {
+		return nil, errors.New("--dry-run cannot predict the CID of an encrypted upload")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() == 0 {
+		return nil, errEmptyFile
+	}
+	contentType, err := sniffContentType(file)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := dryRunUpload(file, newFileHeader(filepath.Base(path), info.Size(), contentType))
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// sendFileToServer posts the file at path to the server's /upload endpoint.
+func sendFileToServer(path string, opts cliOptions) (*uploadResult, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening file: %w", err)
+	}
+	defer file.Close()
+
+	// The server would refuse it; don't spend a request finding out.
+	if info, err := file.Stat(); err == nil && info.Size() == 0 {
+		return nil, errEmptyFile
+	}
+	return sendToServer(file, filepath.Base(path), opts)
+}
+
+// sendStdinToServer uploads standard input under the --name filename,
+// refusing streams larger than MAX_UPLOAD_BYTES.
+func sendStdinToServer(stdin io.Reader, opts cliOptions) (*uploadResult, error) {
+	if opts.name == "" {
+		return nil, errors.New("--stdin requires --name")
+	}
+	if opts.dryRun {
+		return nil, errors.New("--dry-run does not support --stdin")
+	}
+	return sendToServer(&maxBytesReader{r: stdin, remaining: maxUploadBytes}, opts.name, opts)
+}
+
+// maxBytesReader fails once more than remaining bytes have been read.
+type maxBytesReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (m *maxBytesReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > m.remaining+1 {
+		p = p[:m.remaining+1]
+	}
+	n, err := m.r.Read(p)
+	if int64(n) > m.remaining {
+		return 0, fmt.Errorf("input exceeds max size of %d bytes", maxUploadBytes)
+	}
+	m.remaining -= int64(n)
+	return n, err
+}
+
+func sendToServer(file io.Reader, filename string, opts cliOptions) (*uploadResult, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	if opts.name != "" {
+		writer.WriteField("name", opts.name)
+	}
+	if opts.group != "" {
+		writer.WriteField("group_id", opts.group)
+	}
+	if opts.private {
+		writer.WriteField("private", "true")
+	}
+
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		return nil, fmt.Errorf("creating form file: %w", err)
+	}
+
+	// Streams such as --stdin only show they are empty once read.
+	var n int64
+	if encryptionKey != nil {
+		plain, err := io.ReadAll(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading file: %w", err)
+		}
+		if len(plain) == 0 {
+			return nil, errEmptyFile
+		}
+		sealed, err := encryptBytes(plain)
+		if err != nil {
+			return nil, fmt.Errorf("encrypting file: %w", err)
+		}
+		_, err = part.Write(sealed)
+	} else {
+		n, err = io.Copy(part, file)
+		if err == nil && n == 0 {
+			return nil, errEmptyFile
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("copying file: %w", err)
+	}
+	writer.Close()
+
+	size := int64(body.Len())
+	var reqBody io.Reader = body
+	if opts.progress {
+		bar := newProgressReader(body, os.Stderr, filename, size)
+		defer bar.finish()
+		reqBody = bar
+	}
+	req, err := http.NewRequest("POST", serverURL+"/upload", reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	setAPIToken(req)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result, err := decodeServerResult(resp)
+	if err != nil {
+		return nil, err
+	}
+	result.Filename = filename
+	return result, nil
+}
+
+// sendURLToServer asks the server to download and pin rawURL.
+func sendURLToServer(rawURL string) (*uploadResult, error) {
+	payload, err := json.Marshal(map[string]string{"url": rawURL})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", serverURL+"/upload-url", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setAPIToken(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return decodeServerResult(resp)
+}
+
+// setAPIToken authenticates req against a server that has API_TOKEN set.
+func setAPIToken(req *http.Request) {
+	if apiToken != "" {
+		req.Header.Set("Authorization", "Bearer "+apiToken)
+	}
+}
+
+func decodeServerResult(resp *http.Response) (*uploadResult, error) {
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+
+	var result uploadResult
+	if resp.StatusCode != 200 || json.Unmarshal(respBody, &result) != nil {
+		return nil, fmt.Errorf("server returned %d: %s", resp.StatusCode, string(respBody))
+	}
+	return &result, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useFailingServer points the CLI at a server that fails the test if any
+// request reaches it.
+func useFailingServer(t *testing.T) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request to %s", r.URL.Path)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(srv.Close)
+	oldURL := serverURL
+	serverURL = srv.URL
+	t.Cleanup(func() { serverURL = oldURL })
+}
+
+func TestCLIRejectsEmptyFile(t *testing.T) {
+	useFailingServer(t)
+	path := filepath.Join(t.TempDir(), "empty.txt")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dryRun := range []bool{false, true} {
+		if _, err := uploadFile(path, cliOptions{dryRun: dryRun}); !errors.Is(err, errEmptyFile) {
+			t.Errorf("dryRun=%v: err = %v, want %v", dryRun, err, errEmptyFile)
+		}
+	}
+}
+
+func TestCLIRejectsEmptyStdin(t *testing.T) {
+	useFailingServer(t)
+	_, err := sendStdinToServer(strings.NewReader(""), cliOptions{name: "empty.txt"})
+	if !errors.Is(err, errEmptyFile) {
+		t.Errorf("err = %v, want %v", err, errEmptyFile)
+	}
+}
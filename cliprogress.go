@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	progressBarWidth    = 30
+	progressRedrawEvery = 100 * time.Millisecond
+)
+
+// stderrIsTerminal reports whether stderr is an interactive terminal, where
+// a redrawn progress bar makes sense.
+func stderrIsTerminal() bool {
+	info, err := os.Stderr.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// progressReader draws a progress bar on w as r is read. A total of zero or
+// less shows only the bytes transferred.
+type progressReader struct {
+	r      io.Reader
+	w      io.Writer
+	label  string
+	total  int64
+	read   int64
+	drawn  time.Time
+	closed bool
+}
+
+func newProgressReader(r io.Reader, w io.Writer, label string, total int64) *progressReader {
+	return &progressReader{r: r, w: w, label: label, total: total}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+	if err == io.EOF {
+		// The server only answers once it has pinned the file.
+		p.draw()
+		fmt.Fprint(p.w, "  waiting for the server...")
+	} else if time.Since(p.drawn) >= progressRedrawEvery {
+		p.draw()
+	}
+	return n, err
+}
+
+// finish ends the bar's line so later output starts on a fresh one.
+func (p *progressReader) finish() {
+	if !p.closed && !p.drawn.IsZero() {
+		fmt.Fprintln(p.w)
+	}
+	p.closed = true
+}
+
+func (p *progressReader) draw() {
+	p.drawn = time.Now()
+	if p.total <= 0 {
+		fmt.Fprintf(p.w, "\r\033[K%s %s", p.label, formatBytes(p.read))
+		return
+	}
+	done := p.read
+	if done > p.total {
+		done = p.total
+	}
+	filled := int(done * progressBarWidth / p.total)
+	fmt.Fprintf(p.w, "\r\033[K%s [%s%s] %3d%% %s / %s", p.label,
+		strings.Repeat("#", filled), strings.Repeat(".", progressBarWidth-filled),
+		done*100/p.total, formatBytes(done), formatBytes(p.total))
+}
+
+// formatBytes renders n in binary units, e.g. "12.3 MiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/compress"
+)
+
+// compressionLevel, from COMPRESSION_LEVEL, applies to gzip, deflate and
+// brotli responses alike.
+var compressionLevel = compress.LevelDefault
+
+func parseCompressionLevel(v string) (compress.Level, error) {
+	switch strings.ToLower(v) {
+	case "disabled", "off":
+		return compress.LevelDisabled, nil
+	case "default":
+		return compress.LevelDefault, nil
+	case "best-speed", "speed":
+		return compress.LevelBestSpeed, nil
+	case "best-compression", "best":
+		return compress.LevelBestCompression, nil
+	default:
+		return 0, fmt.Errorf("must be one of disabled, default, best-speed, best-compression")
+	}
+}
+
+// responseCompression compresses responses for clients that send
+// Accept-Encoding. Content proxied from the gateway is passed through as
+// is, since it is streamed and often already compressed media, and so are
+// the progress event streams, which clients expect to arrive event by event.
+func responseCompression() fiber.Handler {
+	return compress.New(compress.Config{
+		Level: compressionLevel,
+		Next: func(c *fiber.Ctx) bool {
+			return strings.HasPrefix(c.Path(), "/cid/") || strings.HasPrefix(c.Path(), "/ws/") || strings.HasSuffix(c.Path(), "/progress")
+		},
+	})
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting as the raw text it was given in. Each field is
+// named by its environment variable; a config file uses the same names in
+// lower case. loadEnv parses and validates the values into the globals the
+// rest of the server reads.
+type Config struct {
+	Port                   string `config:"PORT"`
+	ServerURL              string `config:"SERVER_URL"`
+	AllowedOrigins         string `config:"ALLOWED_ORIGINS"`
+	APIToken               string `config:"API_TOKEN"`
+	AllowTenantCredentials string `config:"ALLOW_TENANT_CREDENTIALS"`
+	LogLevel               string `config:"LOG_LEVEL"`
+	DebugCaptureDir        string `config:"DEBUG_CAPTURE_DIR"`
+	EnableMetrics          string `config:"ENABLE_METRICS"`
+	StorageProvider        string `config:"STORAGE_PROVIDER"`
+	DBPath                 string `config:"DB_PATH"`
+
+	PinataJWT          string `config:"PINATA_JWT"`
+	PinataAPIKey       string `config:"PINATA_API_KEY"`
+	PinataSecretAPIKey string `config:"PINATA_SECRET_API_KEY"`
+	PinataAPIURL       string `config:"PINATA_API_URL"`
+	PinataMaxRetries   string `config:"PINATA_MAX_RETRIES"`
+	PinataTimeout      string `config:"PINATA_TIMEOUT"`
+	MaxRetryDelay      string `config:"MAX_RETRY_DELAY"`
+	IPFSAPIURL         string `config:"IPFS_API_URL"`
+
+	IPFSGateway          string `config:"IPFS_GATEWAY"`
+	GatewayCacheControl  string `config:"GATEWAY_CACHE_CONTROL"`
+	GatewayByType        string `config:"GATEWAY_BY_TYPE"`
+	PinataGatewayDomain  string `config:"PINATA_GATEWAY_DOMAIN"`
+	PinataGatewayToken   string `config:"PINATA_GATEWAY_TOKEN"`
+	RequireCustomGateway string `config:"REQUIRE_CUSTOM_GATEWAY"`
+
+	MaxUploadBytes       string `config:"MAX_UPLOAD_BYTES"`
+	MaxTotalUploadBytes  string `config:"MAX_TOTAL_UPLOAD_BYTES"`
+	MaxFilesPerRequest   string `config:"MAX_FILES_PER_REQUEST"`
+	MaxArchiveEntries    string `config:"MAX_ARCHIVE_ENTRIES"`
+	MaxArchiveBytes      string `config:"MAX_ARCHIVE_BYTES"`
+	MaxConcurrentUploads string `config:"MAX_CONCURRENT_UPLOADS"`
+	MaxQueuedUploads     string `config:"MAX_QUEUED_UPLOADS"`
+	QueueTimeout         string `config:"QUEUE_TIMEOUT"`
+	RequestTimeout       string `config:"REQUEST_TIMEOUT"`
+	AllowedMIMETypes     string `config:"ALLOWED_MIME_TYPES"`
+	CIDVersion           string `config:"CID_VERSION"`
+	PinNameTemplate      string `config:"PIN_NAME_TEMPLATE"`
+	HashAlgorithms       string `config:"HASH_ALGORITHMS"`
+	VerifyCID            string `config:"VERIFY_CID"`
+	VerifyDownload       string `config:"VERIFY_DOWNLOAD"`
+	WaitForPin           string `config:"WAIT_FOR_PIN"`
+	PinWaitTimeout       string `config:"PIN_WAIT_TIMEOUT"`
+	StripEXIF            string `config:"STRIP_EXIF"`
+	CompressBeforePin    string `config:"COMPRESS_BEFORE_PIN"`
+	GenerateThumbnails   string `config:"GENERATE_THUMBNAILS"`
+	EncryptionKey        string `config:"ENCRYPTION_KEY"`
+	ClamAVAddress        string `config:"CLAMAV_ADDRESS"`
+	DedupCacheSize       string `config:"DEDUP_CACHE_SIZE"`
+	InlineThreshold      string `config:"INLINE_THRESHOLD"`
+	UploadTmpDir         string `config:"UPLOAD_TMP_DIR"`
+	WorkerCount          string `config:"WORKER_COUNT"`
+	SpoolDir             string `config:"SPOOL_DIR"`
+	CompressionLevel     string `config:"COMPRESSION_LEVEL"`
+
+	RateLimit      string `config:"RATE_LIMIT"`
+	RateWindow     string `config:"RATE_WINDOW"`
+	TrustedProxies string `config:"TRUSTED_PROXIES"`
+	ProxyHeader    string `config:"PROXY_HEADER"`
+
+	WebhookURL    string `config:"WEBHOOK_URL"`
+	WebhookSecret string `config:"WEBHOOK_SECRET"`
+
+	TLSCertFile   string `config:"TLS_CERT_FILE"`
+	TLSKeyFile    string `config:"TLS_KEY_FILE"`
+	TLSAutoDomain string `config:"TLS_AUTO_DOMAIN"`
+	TLSCacheDir   string `config:"TLS_CACHE_DIR"`
+}
+
+// config is the Config loaded at startup.
+var config Config
+
+// splitConfigFlag removes a --config path (or --config=path) from args,
+// wherever it appears, and returns the path with the remaining arguments.
+func splitConfigFlag(args []string) (string, []string) {
+	var path string
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--config" && i+1 < len(args):
+			path = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--config="):
+			path = strings.TrimPrefix(args[i], "--config=")
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+	return path, rest
+}
+
+// loadConfig reads the YAML or JSON file at path, if any, and then lets
+// every non-empty environment variable override the file.
+func loadConfig(path string) (Config, error) {
+	var cfg Config
+	if path != "" {
+		file, err := readConfigFile(path)
+		if err != nil {
+			return cfg, err
+		}
+		if err := cfg.apply(file); err != nil {
+			return cfg, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	v := reflect.ValueOf(&cfg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if env := os.Getenv(v.Type().Field(i).Tag.Get("config")); env != "" {
+			v.Field(i).SetString(env)
+		}
+	}
+	return cfg, nil
+}
+
+func readConfigFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &file)
+	case ".json":
+		err = json.Unmarshal(data, &file)
+	default:
+		return nil, fmt.Errorf("%s: config file must end in .yaml, .yml or .json", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return file, nil
+}
+
+// apply copies the settings of a decoded config file into cfg. Keys match
+// the environment variable names case-insensitively, and unknown keys are
+// rejected so a typo doesn't silently leave a setting at its default.
+func (cfg *Config) apply(file map[string]interface{}) error {
+	fields := map[string]reflect.Value{}
+	v := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		fields[v.Type().Field(i).Tag.Get("config")] = v.Field(i)
+	}
+
+	keys := make([]string, 0, len(file))
+	for key := range file {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		field, ok := fields[strings.ToUpper(key)]
+		if !ok {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+		s, err := configString(file[key])
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		field.SetString(s)
+	}
+	return nil
+}
+
+// configString renders a config file value the way it would be written in
+// an environment variable. Lists become comma-separated.
+func configString(value interface{}) (string, error) {
+	switch val := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return val, nil
+	case bool:
+		return strconv.FormatBool(val), nil
+	case int:
+		return strconv.Itoa(val), nil
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), nil
+	case []interface{}:
+		items := make([]string, len(val))
+		for i, item := range val {
+			s, err := configString(item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", fmt.Errorf("must be a string, number, boolean or list, not %T", value)
+	}
+}
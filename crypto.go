@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// encryptionKey is the AES-256 key from ENCRYPTION_KEY. When set, the CLI
+// encrypts file contents before sending them; the server never sees the key
+// and pins whatever bytes it receives as-is, so the resulting CID addresses
+// the ciphertext. Encrypted uploads carry no recognizable content type, so
+// ALLOWED_MIME_TYPES must permit application/octet-stream for them.
+var encryptionKey []byte
+
+func newGCM() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptBytes seals plain with AES-256-GCM and prepends the random nonce.
+func encryptBytes(plain []byte) ([]byte, error) {
+	gcm, err := newGCM()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, nil), nil
+}
+
+// decryptBytes reverses encryptBytes.
+func decryptBytes(data []byte) ([]byte, error) {
+	gcm, err := newGCM()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, sealed := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, sealed, nil)
+}
+
+// cliDecrypt implements `decrypt [--out file] <cid>`: it fetches the CID
+// from the configured gateway and decrypts it with ENCRYPTION_KEY.
+func cliDecrypt(args []string) {
+	flags := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	out := flags.String("out", "", "write the plaintext to this file instead of stdout")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: decrypt [--out file] <cid>")
+		os.Exit(2)
+	}
+	if encryptionKey == nil {
+		fmt.Fprintln(os.Stderr, "Decrypt failed: ENCRYPTION_KEY is not set")
+		os.Exit(1)
+	}
+
+	plain, err := fetchAndDecrypt(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Decrypt failed:", err)
+		os.Exit(1)
+	}
+
+	if *out == "" {
+		os.Stdout.Write(plain)
+		return
+	}
+	if err := os.WriteFile(*out, plain, 0o600); err != nil {
+		fmt.Fprintln(os.Stderr, "Decrypt failed:", err)
+		os.Exit(1)
+	}
+}
+
+func fetchAndDecrypt(cid string) ([]byte, error) {
+	if !isValidCID(cid) {
+		return nil, fmt.Errorf("%w %q", errInvalidCID, cid)
+	}
+
+	resp, err := fetchClient.Get(gatewayURL(cid))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("gateway returned %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return decryptBytes(data)
+}
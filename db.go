@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// uploadDB is the optional local upload index, opened when DB_PATH is set.
+// A nil uploadDB disables all bookkeeping.
+var uploadDB *sql.DB
+
+const uploadsSchema = `
+CREATE TABLE IF NOT EXISTS uploads (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	cid        TEXT    NOT NULL,
+	filename   TEXT    NOT NULL,
+	size       INTEGER NOT NULL,
+	name       TEXT    NOT NULL DEFAULT '',
+	created_at TEXT    NOT NULL
+);
+CREATE INDEX IF NOT EXISTS uploads_created_at ON uploads (created_at);
+`
+
+// uploadsSHA256Column, uploadsContentTypeColumn and uploadsUnpinnedColumn
+// are added separately so databases created before deduplication, /stats
+// and unpin tracking existed are migrated in place.
+const (
+	uploadsSHA256Column = `
+ALTER TABLE uploads ADD COLUMN sha256 TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS uploads_sha256 ON uploads (sha256);
+`
+	uploadsContentTypeColumn = `
+ALTER TABLE uploads ADD COLUMN content_type TEXT NOT NULL DEFAULT '';
+`
+	uploadsUnpinnedColumn = `
+ALTER TABLE uploads ADD COLUMN unpinned INTEGER NOT NULL DEFAULT 0;
+`
+)
+
+// topContentTypesLimit is how many content types /stats lists.
+const topContentTypesLimit = 5
+
+// dbTimeFormat sorts lexicographically, so date ranges can be compared as
+// plain strings in SQL.
+const dbTimeFormat = "2006-01-02T15:04:05Z"
+
+type uploadRecord struct {
+	ID          int64     `json:"id"`
+	CID         string    `json:"cid"`
+	Filename    string    `json:"filename"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	Name        string    `json:"name"`
+	SHA256      string    `json:"sha256"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// uploadStats summarizes the upload index for /stats.
+type uploadStats struct {
+	TotalUploads    int64              `json:"total_uploads"`
+	TotalBytes      int64              `json:"total_bytes"`
+	UploadsLast24h  int64              `json:"uploads_last_24h"`
+	TopContentTypes []contentTypeCount `json:"top_content_types"`
+}
+
+type contentTypeCount struct {
+	ContentType string `json:"content_type"`
+	Uploads     int64  `json:"uploads"`
+}
+
+type uploadFilter struct {
+	filename string
+	from, to time.Time
+	limit    int
+}
+
+func openUploadDB(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(uploadsSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := addColumnIfMissing(db, "sha256", uploadsSHA256Column); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := addColumnIfMissing(db, "content_type", uploadsContentTypeColumn); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := addColumnIfMissing(db, "unpinned", uploadsUnpinnedColumn); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// addColumnIfMissing runs migration unless the uploads table already has
+// column.
+func addColumnIfMissing(db *sql.DB, column, migration string) error {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('uploads') WHERE name = ?`, column).Scan(&n)
+	if err != nil || n > 0 {
+		return err
+	}
+	_, err = db.Exec(migration)
+	return err
+}
+
+func recordUpload(ctx context.Context, rec uploadRecord) error {
+	if uploadDB == nil {
+		return nil
+	}
+	_, err := uploadDB.ExecContext(ctx,
+		`INSERT INTO uploads (cid, filename, size, content_type, name, sha256, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		rec.CID, rec.Filename, rec.Size, rec.ContentType, rec.Name, rec.SHA256, rec.CreatedAt.UTC().Format(dbTimeFormat))
+	return err
+}
+
+// markUploadUnpinned stops uploads of cid from being offered for dedup.
+// Their rows stay in the index for /uploads and /stats.
+func markUploadUnpinned(ctx context.Context, cid string) error {
+	if uploadDB == nil {
+		return nil
+	}
+	_, err := uploadDB.ExecContext(ctx, `UPDATE uploads SET unpinned = 1 WHERE cid = ?`, cid)
+	return err
+}
+
+// lookupUploadBySHA256 returns the most recent CID recorded for sum that is
+// still pinned, or "" when there is none or no index is configured. A
+// non-nil cidVersion only matches CIDs of that version (v0 CIDs are the
+// ones starting with Qm).
+func lookupUploadBySHA256(ctx context.Context, sum string, cidVersion *int) (string, error) {
+	if uploadDB == nil {
+		return "", nil
+	}
+	query := `SELECT cid FROM uploads WHERE sha256 = ? AND unpinned = 0`
+	if cidVersion != nil && *cidVersion == 0 {
+		query += ` AND cid LIKE 'Qm%'`
+	} else if cidVersion != nil {
+		query += ` AND cid NOT LIKE 'Qm%'`
+	}
+	var cid string
+	err := uploadDB.QueryRowContext(ctx, query+` ORDER BY id DESC LIMIT 1`, sum).Scan(&cid)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return cid, err
+}
+
+// queryUploads returns the newest uploads matching filter. Filename matches
+// as a substring; zero from/to times leave that end of the range open.
+func queryUploads(ctx context.Context, filter uploadFilter) ([]uploadRecord, error) {
+	query := `SELECT id, cid, filename, size, content_type, name, sha256, created_at FROM uploads WHERE 1=1`
+	var args []interface{}
+	if filter.filename != "" {
+		query += ` AND filename LIKE ?`
+		args = append(args, "%"+filter.filename+"%")
+	}
+	if !filter.from.IsZero() {
+		query += ` AND created_at >= ?`
+		args = append(args, filter.from.UTC().Format(dbTimeFormat))
+	}
+	if !filter.to.IsZero() {
+		query += ` AND created_at <= ?`
+		args = append(args, filter.to.UTC().Format(dbTimeFormat))
+	}
+	query += ` ORDER BY created_at DESC, id DESC LIMIT ?`
+	args = append(args, filter.limit)
+
+	rows, err := uploadDB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []uploadRecord{}
+	for rows.Next() {
+		var rec uploadRecord
+		var createdAt string
+		if err := rows.Scan(&rec.ID, &rec.CID, &rec.Filename, &rec.Size, &rec.ContentType, &rec.Name, &rec.SHA256, &createdAt); err != nil {
+			return nil, err
+		}
+		rec.CreatedAt, _ = time.Parse(dbTimeFormat, createdAt)
+		records = append(records, rec)
+	}
+	return records, rows.Err()
+}
+
+// queryUploadStats aggregates the upload index, counting uploads since since
+// separately. Rows recorded before content types were stored are left out
+// of the content type ranking. Without an index every figure is zero.
+func queryUploadStats(ctx context.Context, since time.Time) (uploadStats, error) {
+	stats := uploadStats{TopContentTypes: []contentTypeCount{}}
+	if uploadDB == nil {
+		return stats, nil
+	}
+
+	err := uploadDB.QueryRowContext(ctx,
+		`SELECT COUNT(*), COALESCE(SUM(size), 0), COUNT(CASE WHEN created_at >= ? THEN 1 END) FROM uploads`,
+		since.UTC().Format(dbTimeFormat)).Scan(&stats.TotalUploads, &stats.TotalBytes, &stats.UploadsLast24h)
+	if err != nil {
+		return stats, err
+	}
+
+	rows, err := uploadDB.QueryContext(ctx,
+		`SELECT content_type, COUNT(*) AS n FROM uploads WHERE content_type != '' GROUP BY content_type ORDER BY n DESC, content_type LIMIT ?`,
+		topContentTypesLimit)
+	if err != nil {
+		return stats, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tc contentTypeCount
+		if err := rows.Scan(&tc.ContentType, &tc.Uploads); err != nil {
+			return stats, err
+		}
+		stats.TopContentTypes = append(stats.TopContentTypes, tc)
+	}
+	return stats, rows.Err()
+}
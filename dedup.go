@@ -0,0 +1,114 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+)
+
+const defaultDedupCacheSize = 1000
+
+// dedupCache maps the SHA-256 of uploaded content to the CID it was pinned
+// under. IPFS is content-addressed, so identical bytes can reuse the CID
+// instead of being pinned again. Least recently used entries are evicted
+// once the cache holds size entries.
+type dedupCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+}
+
+type dedupEntry struct {
+	sha256 string
+	cid    string
+}
+
+var uploadDedup = newDedupCache(defaultDedupCacheSize)
+
+func newDedupCache(size int) *dedupCache {
+	return &dedupCache{size: size, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (d *dedupCache) get(sum string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	el, ok := d.entries[sum]
+	if !ok {
+		return "", false
+	}
+	d.order.MoveToFront(el)
+	return el.Value.(*dedupEntry).cid, true
+}
+
+func (d *dedupCache) add(sum, cid string) {
+	if d.size <= 0 {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if el, ok := d.entries[sum]; ok {
+		el.Value.(*dedupEntry).cid = cid
+		d.order.MoveToFront(el)
+		return
+	}
+	d.entries[sum] = d.order.PushFront(&dedupEntry{sha256: sum, cid: cid})
+	for d.order.Len() > d.size {
+		oldest := d.order.Back()
+		d.order.Remove(oldest)
+		delete(d.entries, oldest.Value.(*dedupEntry).sha256)
+	}
+}
+
+// forgetCID drops every hash that maps to cid.
+func (d *dedupCache) forgetCID(cid string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for el := d.order.Front(); el != nil; {
+		next := el.Next()
+		if entry := el.Value.(*dedupEntry); entry.cid == cid {
+			d.order.Remove(el)
+			delete(d.entries, entry.sha256)
+		}
+		el = next
+	}
+}
+
+// forgetUnpinned clears everything that would still treat cid as pinned,
+// so a later upload of the same bytes is pinned again rather than handed
+// the CID that is gone.
+func forgetUnpinned(cid string) {
+	pinStatuses.forget(cid)
+	uploadDedup.forgetCID(cid)
+	if err := markUploadUnpinned(context.Background(), cid); err != nil {
+		logEvent("error", "recording unpin failed", map[string]interface{}{"cid": cid, "error": err.Error()})
+	}
+}
+
+// dedupKey distinguishes the CIDs one content hash gets under each
+// requested CID version; nil means the backend's default.
+func dedupKey(sum string, cidVersion *int) string {
+	if cidVersion == nil {
+		return sum
+	}
+	return fmt.Sprintf("%s/v%d", sum, *cidVersion)
+}
+
+// lookupDedup returns the CID previously pinned for sum under cidVersion,
+// consulting the upload index when the in-memory cache misses.
+func lookupDedup(ctx context.Context, sum string, cidVersion *int) (string, bool) {
+	key := dedupKey(sum, cidVersion)
+	if cid, ok := uploadDedup.get(key); ok {
+		return cid, true
+	}
+	cid, err := lookupUploadBySHA256(ctx, sum, cidVersion)
+	if err != nil || cid == "" {
+		return "", false
+	}
+	uploadDedup.add(key, cid)
+	return cid, true
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestForgetUnpinnedStopsDedup(t *testing.T) {
+	db, err := openUploadDB(filepath.Join(t.TempDir(), "uploads.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldDB, oldDedup := uploadDB, uploadDedup
+	uploadDB, uploadDedup = db, newDedupCache(defaultDedupCacheSize)
+	t.Cleanup(func() {
+		uploadDB, uploadDedup = oldDB, oldDedup
+		db.Close()
+	})
+
+	ctx := context.Background()
+	const sum = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	const other = "486ea46224d1bb4fb680f34f7c9ad96a8f24ec88be73ea8e5a6c65260e9cb8a7"
+	rec := uploadRecord{CID: testCID, Filename: "hello.txt", Size: 5, SHA256: sum, CreatedAt: time.Now()}
+	if err := recordUpload(ctx, rec); err != nil {
+		t.Fatal(err)
+	}
+	uploadDedup.add(dedupKey(sum, nil), testCID)
+	uploadDedup.add(dedupKey(other, nil), "bafkreiother")
+
+	forgetUnpinned(testCID)
+
+	if cid, ok := uploadDedup.get(dedupKey(sum, nil)); ok {
+		t.Errorf("cache still maps the unpinned content to %s", cid)
+	}
+	if cid, ok := lookupDedup(ctx, sum, nil); ok {
+		t.Errorf("lookupDedup still offers %s after unpin", cid)
+	}
+	if _, ok := uploadDedup.get(dedupKey(other, nil)); !ok {
+		t.Error("forgetting one CID evicted another")
+	}
+
+	// Pinning the same bytes again makes them reusable.
+	if err := recordUpload(ctx, rec); err != nil {
+		t.Fatal(err)
+	}
+	if cid, ok := lookupDedup(ctx, sum, nil); !ok || cid != testCID {
+		t.Errorf("after re-pin lookupDedup = %q, %v; want %s", cid, ok, testCID)
+	}
+}
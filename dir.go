@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"ipfs-fiber-uploader/pinata"
+)
+
+// dirUploadResult is printed by `cli --dir`. Files maps each relative path
+// to its CID; with --wrap, CID is the directory's own CID instead.
+type dirUploadResult struct {
+	CID     string            `json:"cid,omitempty"`
+	IpfsURL string            `json:"ipfs_url,omitempty"`
+	Files   map[string]string `json:"files,omitempty"`
+}
+
+// cliUploadDir uploads the files under opts.dir, either one by one through
+// the server or, with --wrap, as a single directory pinned to Pinata.
+func cliUploadDir(opts cliOptions) error {
+	paths, err := walkUploadDir(opts.dir, opts.ignore)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no files to upload in %s", opts.dir)
+	}
+
+	var result dirUploadResult
+	if opts.wrap && opts.dryRun {
+		return errors.New("--dry-run does not support --wrap")
+	}
+	if opts.wrap {
+		result.CID, err = pinDirectory(opts, paths)
+		if err != nil {
+			return err
+		}
+		result.IpfsURL = gatewayURL(result.CID)
+	} else {
+		result.Files = make(map[string]string, len(paths))
+		for _, rel := range paths {
+			res, err := uploadFile(filepath.Join(opts.dir, filepath.FromSlash(rel)), opts)
+			if err != nil {
+				return fmt.Errorf("%s: %w", rel, err)
+			}
+			result.Files[rel] = res.CID
+		}
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}
+
+// walkUploadDir returns the slash-separated paths of the regular files
+// under root, skipping hidden entries and anything matching ignore.
+func walkUploadDir(root, ignore string) ([]string, error) {
+	if ignore != "" {
+		if _, err := filepath.Match(ignore, ""); err != nil {
+			return nil, fmt.Errorf("invalid --ignore pattern %q: %w", ignore, err)
+		}
+	}
+
+	var paths []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") || ignoredPath(ignore, d.Name(), rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.Type().IsRegular() {
+			paths = append(paths, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return paths, err
+}
+
+// ignoredPath matches the --ignore glob against both the entry's name and
+// its path relative to the upload root.
+func ignoredPath(ignore, name, rel string) bool {
+	if ignore == "" {
+		return false
+	}
+	if ok, _ := filepath.Match(ignore, name); ok {
+		return true
+	}
+	ok, _ := filepath.Match(ignore, rel)
+	return ok
+}
+
+// pinDirectory pins paths to Pinata directly as one directory, bypassing
+// the server since /upload only takes single files.
+func pinDirectory(opts cliOptions, paths []string) (string, error) {
+	dirPinner, ok := pinner.(directoryPinner)
+	if !ok {
+		return "", fmt.Errorf("--wrap requires STORAGE_PROVIDER=pinata")
+	}
+
+	if opts.group != "" {
+		if _, err := uuid.Parse(opts.group); err != nil {
+			return "", errors.New("--group must be a Pinata group UUID")
+		}
+	}
+
+	files := make([]pinata.DirFile, len(paths))
+	for i, rel := range paths {
+		fullPath := filepath.Join(opts.dir, filepath.FromSlash(rel))
+		files[i] = pinata.DirFile{
+			Path: rel,
+			Open: func() (io.ReadCloser, error) { return openDirFile(fullPath) },
+		}
+	}
+
+	absDir, err := filepath.Abs(opts.dir)
+	if err != nil {
+		return "", err
+	}
+	dirName := filepath.Base(absDir)
+	ctx, cancel := context.WithTimeout(context.Background(), pinataTimeout)
+	defer cancel()
+
+	metadata := pinata.Metadata{Name: opts.name}
+	if opts.private {
+		metadata = privateMetadata(metadata)
+	}
+	return dirPinner.PinDirectory(ctx, dirName, files, metadata, pinata.Options{CIDVersion: cidVersion, GroupID: opts.group})
+}
+
+// openDirFile opens path for a --wrap upload, encrypting it in memory first
+// when ENCRYPTION_KEY is set.
+func openDirFile(path string) (io.ReadCloser, error) {
+	if encryptionKey == nil {
+		return os.Open(path)
+	}
+	plain, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := encryptBytes(plain)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(sealed)), nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+const drainLogInterval = time.Second
+
+// activeUploads counts calls to uploadToIPFS still running, whether they
+// serve a request or a background job, and activeUploadFiles names them so
+// shutdown can say which ones it cut off.
+var (
+	activeUploads     int64
+	activeUploadFiles = struct {
+		sync.Mutex
+		next  uint64
+		names map[uint64]string
+	}{names: map[uint64]string{}}
+)
+
+// trackUpload registers an upload of filename until the returned func is
+// called.
+func trackUpload(filename string) func() {
+	atomic.AddInt64(&activeUploads, 1)
+	activeUploadFiles.Lock()
+	id := activeUploadFiles.next
+	activeUploadFiles.next++
+	activeUploadFiles.names[id] = filename
+	activeUploadFiles.Unlock()
+
+	return func() {
+		activeUploadFiles.Lock()
+		delete(activeUploadFiles.names, id)
+		activeUploadFiles.Unlock()
+		atomic.AddInt64(&activeUploads, -1)
+	}
+}
+
+func activeUploadNames() []string {
+	activeUploadFiles.Lock()
+	defer activeUploadFiles.Unlock()
+
+	names := make([]string, 0, len(activeUploadFiles.names))
+	for _, name := range activeUploadFiles.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// drainUploads waits up to timeout for running uploads to finish, logging
+// how many remain every drainLogInterval. Uploads still running at the
+// deadline are cancelled and logged as interrupted.
+func drainUploads(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	var logged time.Time
+	for {
+		n := atomic.LoadInt64(&activeUploads)
+		if n == 0 {
+			logEvent("info", "uploads drained", nil)
+			return
+		}
+		if time.Now().After(deadline) {
+			cancelUploads()
+			logEvent("warn", "shutdown timeout interrupted uploads", map[string]interface{}{
+				"remaining": n,
+				"filenames": activeUploadNames(),
+			})
+			return
+		}
+		if time.Since(logged) >= drainLogInterval {
+			logEvent("info", "draining uploads", map[string]interface{}{"remaining": n})
+			logged = time.Now()
+		}
+		<-ticker.C
+	}
+}
+
+// uploadsCtx is cancelled by drainUploads once the shutdown timeout runs
+// out, aborting the uploads still going rather than leaving them to be cut
+// off mid-request when the process exits.
+var uploadsCtx, cancelUploads = context.WithCancel(context.Background())
+
+// uploadContext is the context an upload for c runs under. It carries the
+// request ID and debug capture of c and is cancelled by uploadsCtx.
+// fasthttp's own context is only ever cancelled when shutdown begins, which
+// would abort the very uploads drainUploads waits for, and its values are
+// recycled once the handler returns, so they are copied rather than
+// looked up later.
+func uploadContext(c *fiber.Ctx) context.Context {
+	ctx := context.WithValue(uploadsCtx, requestIDKey, utils.CopyString(requestIDFromContext(c.Context())))
+	if req, ok := c.Locals(captureLocalsKey).(*capturedRequest); ok {
+		ctx = context.WithValue(ctx, captureLocalsKey, req)
+	}
+	return ctx
+}
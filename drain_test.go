@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// resetUploadsCtx gives the test a fresh shutdown signal and restores one
+// afterwards, since drainUploads cancels it for good.
+func resetUploadsCtx(t *testing.T) {
+	t.Helper()
+	uploadsCtx, cancelUploads = context.WithCancel(context.Background())
+	t.Cleanup(func() { uploadsCtx, cancelUploads = context.WithCancel(context.Background()) })
+}
+
+func TestRequestTimeoutCancelsUpload(t *testing.T) {
+	resetUploadsCtx(t)
+	requestTimeout = 50 * time.Millisecond
+	t.Cleanup(func() { requestTimeout = 0 })
+
+	var requestID string
+	var cancelled bool
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals(requestIDKey, "req-1")
+		return c.Next()
+	})
+	app.Post("/upload", enforceRequestTimeout, func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		requestID = requestIDFromContext(ctx)
+		select {
+		case <-ctx.Done():
+			cancelled = true
+		case <-time.After(2 * time.Second):
+		}
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/upload", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !cancelled || resp.StatusCode != fiber.StatusServiceUnavailable {
+		t.Errorf("cancelled = %v, status = %d; want the timeout to cancel the upload with 503", cancelled, resp.StatusCode)
+	}
+	if requestID != "req-1" {
+		t.Errorf("request ID = %q, want it carried into the upload context", requestID)
+	}
+}
+
+func TestDrainUploadsCancelsOnlyAtDeadline(t *testing.T) {
+	resetUploadsCtx(t)
+	done := trackUpload("slow.bin")
+	defer done()
+
+	drained := make(chan struct{})
+	go func() {
+		drainUploads(200 * time.Millisecond)
+		close(drained)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if err := uploadsCtx.Err(); err != nil {
+		t.Fatalf("uploads cancelled while still draining: %v", err)
+	}
+	<-drained
+	if uploadsCtx.Err() == nil {
+		t.Error("uploads still running at the deadline were not cancelled")
+	}
+}
+
+func TestDrainUploadsCancelsQueuedJobs(t *testing.T) {
+	resetUploadsCtx(t)
+
+	started := make(chan struct{})
+	var requestID string
+	j, err := enqueueJob("drain-job", "req-2", func(ctx context.Context) (uploadResult, error) {
+		requestID = requestIDFromContext(ctx)
+		close(started)
+		<-ctx.Done()
+		return uploadResult{}, ctx.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Run it by hand rather than through the shared worker pool.
+	if queued := <-jobQueue; queued != j {
+		t.Fatal("dequeued another job")
+	}
+	executed := make(chan struct{})
+	go func() {
+		done := trackUpload("queued.bin")
+		defer done()
+		j.execute()
+		close(executed)
+	}()
+	<-started
+
+	// A job still waiting for a worker when shutdown gives up fails as
+	// soon as one picks it up.
+	waiting, err := enqueueJob("waiting-job", "", func(ctx context.Context) (uploadResult, error) {
+		return uploadResult{}, ctx.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	drainUploads(50 * time.Millisecond)
+	select {
+	case <-executed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("job still running after the drain deadline")
+	}
+	if j.status != jobFailed || requestID != "req-2" {
+		t.Errorf("status = %s, request ID = %q; want failed with req-2", j.status, requestID)
+	}
+
+	(<-jobQueue).execute()
+	if waiting.status != jobFailed {
+		t.Errorf("queued job status = %s, want %s", waiting.status, jobFailed)
+	}
+}
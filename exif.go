@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"os"
+)
+
+// stripEXIF, from STRIP_EXIF, removes metadata segments from JPEG uploads
+// before they are pinned. The image data itself is copied untouched; note
+// that dropping EXIF also drops the orientation tag.
+var stripEXIF bool
+
+var errMalformedJPEG = errors.New("malformed JPEG")
+
+// stripUploadMetadata returns a copy of file with JPEG metadata removed and
+// a header carrying its new size, or file itself when it isn't a JPEG.
+// The copy is streamed into spoolDir rather than held in memory; cleanup
+// removes it and must always be called.
+func stripUploadMetadata(file multipart.File, fileHeader *multipart.FileHeader) (multipart.File, *multipart.FileHeader, func(), error) {
+	noop := func() {}
+
+	magic := make([]byte, 3)
+	if n, _ := file.ReadAt(magic, 0); n < 3 || !bytes.Equal(magic, []byte{0xFF, 0xD8, 0xFF}) {
+		return file, fileHeader, noop, nil
+	}
+
+	spool, err := os.CreateTemp(spoolDir, "ipfs-strip-*")
+	if err != nil {
+		return nil, nil, noop, err
+	}
+	cleanup := func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}
+
+	if err := stripJPEGMetadata(spool, io.NewSectionReader(file, 0, fileHeader.Size)); err != nil {
+		cleanup()
+		return nil, nil, noop, err
+	}
+	size, err := spool.Seek(0, io.SeekCurrent)
+	if err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		cleanup()
+		return nil, nil, noop, err
+	}
+
+	stripped := &multipart.FileHeader{Filename: fileHeader.Filename, Size: size, Header: fileHeader.Header}
+	return spool, stripped, cleanup, nil
+}
+
+// stripJPEGMetadata copies the JPEG in src to dst without its APP1 (EXIF,
+// XMP) and APP13 (IPTC) segments. Everything from the first start-of-scan
+// marker on is copied verbatim, as metadata only appears before it.
+func stripJPEGMetadata(dst io.Writer, src io.Reader) error {
+	r := bufio.NewReader(src)
+	w := bufio.NewWriter(dst)
+
+	soi := make([]byte, 2)
+	if _, err := io.ReadFull(r, soi); err != nil || soi[0] != 0xFF || soi[1] != 0xD8 {
+		return errMalformedJPEG
+	}
+	w.Write(soi)
+
+	for {
+		marker, err := readJPEGMarker(r)
+		if err != nil {
+			return err
+		}
+
+		// Standalone markers carry no length.
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			w.Write([]byte{0xFF, marker})
+			continue
+		}
+		if marker == 0xD9 {
+			w.Write([]byte{0xFF, marker})
+			return w.Flush()
+		}
+
+		lenBytes := make([]byte, 2)
+		if _, err := io.ReadFull(r, lenBytes); err != nil {
+			return errMalformedJPEG
+		}
+		length := int64(lenBytes[0])<<8 | int64(lenBytes[1])
+		if length < 2 {
+			return errMalformedJPEG
+		}
+
+		if marker == 0xE1 || marker == 0xED {
+			if _, err := io.CopyN(io.Discard, r, length-2); err != nil {
+				return errMalformedJPEG
+			}
+			continue
+		}
+
+		w.Write([]byte{0xFF, marker})
+		w.Write(lenBytes)
+		if _, err := io.CopyN(w, r, length-2); err != nil {
+			return errMalformedJPEG
+		}
+
+		if marker == 0xDA {
+			if _, err := io.Copy(w, r); err != nil {
+				return err
+			}
+			return w.Flush()
+		}
+	}
+}
+
+// readJPEGMarker reads the next marker byte, skipping 0xFF fill bytes.
+func readJPEGMarker(r *bufio.Reader) (byte, error) {
+	b, err := r.ReadByte()
+	if err != nil || b != 0xFF {
+		return 0, errMalformedJPEG
+	}
+	for b == 0xFF {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, errMalformedJPEG
+		}
+	}
+	return b, nil
+}
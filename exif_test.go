@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"testing"
+)
+
+// exifWithGPS is an APP1 payload holding a TIFF whose IFD0 points at a GPS
+// IFD with a latitude reference, enough for readers to find GPS data.
+func exifWithGPS() []byte {
+	var tiff bytes.Buffer
+	le := binary.LittleEndian
+	tiff.WriteString("II*\x00")
+	binary.Write(&tiff, le, uint32(8))
+	// IFD0: one GPSInfo (0x8825) LONG entry pointing at offset 26.
+	binary.Write(&tiff, le, uint16(1))
+	binary.Write(&tiff, le, []uint16{0x8825, 4})
+	binary.Write(&tiff, le, []uint32{1, 26})
+	binary.Write(&tiff, le, uint32(0))
+	// GPS IFD: GPSLatitudeRef (0x0001) ASCII "N".
+	binary.Write(&tiff, le, uint16(1))
+	binary.Write(&tiff, le, []uint16{0x0001, 2})
+	binary.Write(&tiff, le, uint32(2))
+	tiff.WriteString("N\x00\x00\x00")
+	binary.Write(&tiff, le, uint32(0))
+	return append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+}
+
+// jpegWithMetadata encodes a small image and inserts APP1 (EXIF with GPS)
+// and APP13 (IPTC) segments right after the start-of-image marker, where
+// cameras put them.
+func jpegWithMetadata(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 16, 8))
+	for x := 0; x < 16; x++ {
+		for y := 0; y < 8; y++ {
+			img.Set(x, y, color.RGBA{uint8(x * 16), uint8(y * 32), 128, 255})
+		}
+	}
+	var plain bytes.Buffer
+	if err := jpeg.Encode(&plain, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	segment := func(marker byte, payload []byte) []byte {
+		return append([]byte{0xFF, marker, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}, payload...)
+	}
+	out := append([]byte{}, plain.Bytes()[:2]...)
+	out = append(out, segment(0xE1, exifWithGPS())...)
+	out = append(out, segment(0xED, []byte("Photoshop 3.0\x008BIM"))...)
+	return append(out, plain.Bytes()[2:]...)
+}
+
+// jpegMarkers lists the markers of the segments before start-of-scan.
+func jpegMarkers(t *testing.T, b []byte) []byte {
+	t.Helper()
+	var markers []byte
+	for i := 2; i+4 <= len(b); {
+		if b[i] != 0xFF {
+			t.Fatalf("no marker at offset %d", i)
+		}
+		marker := b[i+1]
+		markers = append(markers, marker)
+		if marker == 0xDA {
+			break
+		}
+		i += 2 + (int(b[i+2])<<8 | int(b[i+3]))
+	}
+	return markers
+}
+
+func TestStripJPEGMetadata(t *testing.T) {
+	src := jpegWithMetadata(t)
+	if !bytes.Contains(jpegMarkers(t, src), []byte{0xE1}) {
+		t.Fatal("fixture has no APP1 segment")
+	}
+
+	var out bytes.Buffer
+	if err := stripJPEGMetadata(&out, bytes.NewReader(src)); err != nil {
+		t.Fatalf("stripJPEGMetadata: %v", err)
+	}
+	for _, m := range jpegMarkers(t, out.Bytes()) {
+		if m == 0xE1 || m == 0xED {
+			t.Errorf("marker 0x%X survived stripping", m)
+		}
+	}
+	if bytes.Contains(out.Bytes(), []byte("Exif\x00\x00")) {
+		t.Error("EXIF header survived stripping")
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatalf("stripped image doesn't decode: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 16 || b.Dy() != 8 {
+		t.Errorf("stripped image is %dx%d, want 16x8", b.Dx(), b.Dy())
+	}
+}
+
+func TestStripUploadMetadata(t *testing.T) {
+	src := jpegWithMetadata(t)
+	file := bytesFile{bytes.NewReader(src)}
+	header := newFileHeader("photo.jpg", int64(len(src)), "image/jpeg")
+
+	stripped, strippedHeader, cleanup, err := stripUploadMetadata(file, header)
+	if err != nil {
+		t.Fatalf("stripUploadMetadata: %v", err)
+	}
+	defer cleanup()
+
+	got, _ := io.ReadAll(stripped)
+	if int64(len(got)) != strippedHeader.Size || strippedHeader.Size >= header.Size {
+		t.Errorf("stripped size %d (header %d), original %d", len(got), strippedHeader.Size, header.Size)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(got)); err != nil {
+		t.Errorf("stripped upload doesn't decode: %v", err)
+	}
+}
+
+func TestStripUploadMetadataLeavesOtherFiles(t *testing.T) {
+	src := []byte("not a jpeg")
+	file := bytesFile{bytes.NewReader(src)}
+	header := newFileHeader("a.txt", int64(len(src)), "text/plain")
+
+	got, gotHeader, cleanup, err := stripUploadMetadata(file, header)
+	if err != nil {
+		t.Fatalf("stripUploadMetadata: %v", err)
+	}
+	defer cleanup()
+	if got != file || gotHeader != header {
+		t.Error("a non-JPEG upload was replaced")
+	}
+}
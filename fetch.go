@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"syscall"
+	"time"
+)
+
+var (
+	errDownloadTooLarge    = errors.New("download too large")
+	errNonPublicAddress    = errors.New("url must not point at a loopback, private or link-local address")
+	errTooManyURLRedirects = errors.New("url redirected too many times")
+)
+
+const maxURLRedirects = 5
+
+var fetchClient = &http.Client{Timeout: defaultPinataTimeout}
+
+// urlFetchClient fetches the URLs clients hand to /upload-url, and only
+// connects to public addresses so a client can't reach the server's own
+// network or cloud metadata endpoints. The check runs on the address
+// actually dialled, after DNS resolution, so it covers every redirect too.
+var urlFetchClient = &http.Client{
+	Timeout: defaultPinataTimeout,
+	Transport: &http.Transport{
+		// A proxy would be dialled instead of the target, bypassing the
+		// check.
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: 30 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				return checkFetchAddr(address)
+			},
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxURLRedirects {
+			return errTooManyURLRedirects
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return errors.New("url redirected to a non-http(s) URL")
+		}
+		return nil
+	},
+}
+
+// checkFetchAddr is a variable so tests can let urlFetchClient reach a
+// local test server.
+var checkFetchAddr = checkPublicAddr
+
+// checkPublicAddr rejects a dialled host:port whose IP is not publicly
+// routable.
+func checkPublicAddr(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return errNonPublicAddress
+	}
+	return nil
+}
+
+// sharedAddressSpace is 100.64.0.0/10, used for carrier-grade NAT and not
+// covered by net.IP.IsPrivate.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func isPublicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		if ip4[0] == 0 || sharedAddressSpace.Contains(ip4) {
+			return false
+		}
+	}
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+// downloadToTempFile fetches rawURL into a temp file, refusing anything
+// larger than maxUploadBytes. The caller must close and remove the file.
+func downloadToTempFile(ctx context.Context, rawURL string) (*os.File, string, int64, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, "", 0, errors.New("url must be an absolute http(s) URL")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	resp, err := urlFetchClient.Do(req)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, "", 0, fmt.Errorf("remote server returned %d", resp.StatusCode)
+	}
+	if resp.ContentLength > maxUploadBytes {
+		return nil, "", 0, errDownloadTooLarge
+	}
+
+	tmp, err := os.CreateTemp(uploadTmpDir, "ipfs-upload-url-*")
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	// Read one byte past the limit so an oversized body can be detected
+	// even when the server doesn't send Content-Length.
+	n, err := io.Copy(tmp, io.LimitReader(resp.Body, maxUploadBytes+1))
+	if err == nil && n > maxUploadBytes {
+		err = errDownloadTooLarge
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, "", 0, err
+	}
+
+	return tmp, filenameFromResponse(u, resp), n, nil
+}
+
+// filenameFromResponse prefers the Content-Disposition filename and falls
+// back to the last path segment of the URL.
+func filenameFromResponse(u *url.URL, resp *http.Response) string {
+	if cd := resp.Header.Get("Content-Disposition"); cd != "" {
+		if _, params, err := mime.ParseMediaType(cd); err == nil && params["filename"] != "" {
+			return path.Base(params["filename"])
+		}
+	}
+	if name := path.Base(u.Path); name != "/" && name != "." {
+		return name
+	}
+	return "download"
+}
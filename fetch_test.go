@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"::ffff:127.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := isPublicIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("isPublicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestDownloadRejectsNonPublicAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "internal")
+	}))
+	defer srv.Close()
+
+	for _, rawURL := range []string{srv.URL, "http://169.254.169.254/latest/meta-data/"} {
+		if _, _, _, err := downloadToTempFile(context.Background(), rawURL); !errors.Is(err, errNonPublicAddress) {
+			t.Errorf("%s: err = %v, want %v", rawURL, err, errNonPublicAddress)
+		}
+	}
+}
+
+func TestDownloadChecksRedirects(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/file.txt" {
+			io.WriteString(w, "hello")
+			return
+		}
+		http.Redirect(w, r, "http://127.0.0.1:1/secret", http.StatusFound)
+	}))
+	defer srv.Close()
+	// Let the client reach this test server only; everything else still
+	// has to be public.
+	allowed := srv.Listener.Addr().String()
+	checkFetchAddr = func(address string) error {
+		if address == allowed {
+			return nil
+		}
+		return checkPublicAddr(address)
+	}
+	t.Cleanup(func() { checkFetchAddr = checkPublicAddr })
+	uploadTmpDir = t.TempDir()
+	t.Cleanup(func() { uploadTmpDir = "" })
+
+	file, name, n, err := downloadToTempFile(context.Background(), srv.URL+"/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	os.Remove(file.Name())
+	if filepath.Dir(file.Name()) != uploadTmpDir {
+		t.Errorf("downloaded to %s, want a file in UPLOAD_TMP_DIR %s", file.Name(), uploadTmpDir)
+	}
+	if name != "file.txt" || n != 5 {
+		t.Errorf("got %q (%d bytes), want file.txt (5 bytes)", name, n)
+	}
+
+	if _, _, _, err := downloadToTempFile(context.Background(), srv.URL+"/redirect"); !errors.Is(err, errNonPublicAddress) {
+		t.Errorf("redirect to loopback: err = %v, want %v", err, errNonPublicAddress)
+	}
+}
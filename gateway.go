@@ -0,0 +1,223 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// gatewayClient has no overall timeout because responses are streamed to
+// the client for as long as the download takes; only waiting for the
+// upstream headers is bounded.
+var gatewayClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		ResponseHeaderTimeout: 30 * time.Second,
+	},
+}
+
+// gatewayRoute serves content of a matching MIME type from its own gateway.
+type gatewayRoute struct {
+	pattern string // exact ("video/mp4") or wildcard ("image/*")
+	baseURL string // ends in a slash, like ipfsGateway
+}
+
+// gatewaysByType, from GATEWAY_BY_TYPE, is checked in order when building an
+// upload's ipfs_url; unmatched types use gatewayURL.
+var gatewaysByType []gatewayRoute
+
+// parseGatewayRoutes parses comma-separated type=url pairs, e.g.
+// "image/*=https://cdn.example/ipfs/,video/mp4=https://video.example/ipfs/".
+func parseGatewayRoutes(v string) ([]gatewayRoute, error) {
+	var routes []gatewayRoute
+	for _, pair := range strings.Split(v, ",") {
+		pattern, base, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if !ok || !strings.Contains(pattern, "/") {
+			return nil, fmt.Errorf("%q must look like type/subtype=url", pair)
+		}
+		u, err := url.Parse(strings.TrimSpace(base))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%q: gateway must be an absolute http(s) URL", pair)
+		}
+		base = u.String()
+		if !strings.HasSuffix(base, "/") {
+			base += "/"
+		}
+		routes = append(routes, gatewayRoute{pattern: pattern, baseURL: base})
+	}
+	return routes, nil
+}
+
+// uploadGatewayURL builds the ipfs_url returned for file, routing on its
+// detected type, rather than the one the client declared, when
+// GATEWAY_BY_TYPE is set.
+func uploadGatewayURL(cid string, file io.ReadSeeker) string {
+	if len(gatewaysByType) == 0 {
+		return gatewayURL(cid)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return gatewayURL(cid)
+	}
+	contentType, err := sniffContentType(file)
+	if err != nil {
+		return gatewayURL(cid)
+	}
+	for _, route := range gatewaysByType {
+		if mimeTypeMatches(route.pattern, contentType) {
+			return route.baseURL + cid
+		}
+	}
+	return gatewayURL(cid)
+}
+
+// defaultGatewayCacheControl lets browsers and CDNs keep /cid/ responses
+// for a year: a CID always names the same bytes.
+const defaultGatewayCacheControl = "public, max-age=31536000, immutable"
+
+// gatewayCacheControl, from GATEWAY_CACHE_CONTROL, is sent with successful
+// /cid/ responses; GATEWAY_CACHE_CONTROL=off sends none.
+var gatewayCacheControl = defaultGatewayCacheControl
+
+const maxDownloadNameLength = 255
+
+// downloadDisposition builds the Content-Disposition for ?download=name,
+// encoding non-ASCII names as RFC 2231 allows.
+func downloadDisposition(name string) (string, error) {
+	if name == "" || name == "." || name == ".." || len(name) > maxDownloadNameLength ||
+		strings.ContainsAny(name, `/\`) || strings.IndexFunc(name, isControlRune) >= 0 {
+		return "", errors.New("download must be a plain filename like report.pdf")
+	}
+	return mime.FormatMediaType("attachment", map[string]string{"filename": name}), nil
+}
+
+func isControlRune(r rune) bool { return r < 0x20 || r == 0x7f }
+
+// proxiedHeaders are copied from the gateway response so clients can seek
+// and cache media.
+var proxiedHeaders = []string{
+	fiber.HeaderContentType,
+	fiber.HeaderContentLength,
+	fiber.HeaderContentRange,
+	fiber.HeaderAcceptRanges,
+	fiber.HeaderETag,
+	fiber.HeaderLastModified,
+}
+
+// cidProxyHandler streams content for a CID from the configured gateway,
+// forwarding Range requests and propagating the upstream status; with
+// VERIFY_DOWNLOAD the whole file is fetched and checked instead. Content
+// pinned gzipped by COMPRESS_BEFORE_PIN is served under its original type,
+// still compressed to clients accepting gzip and decoded for the rest.
+// ?download=name makes browsers save the content as name.
+func cidProxyHandler(c *fiber.Ctx) error {
+	cid := c.Params("cid")
+	if !isValidCID(cid) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid CID"})
+	}
+	var disposition string
+	if name := c.Query("download"); name != "" {
+		d, err := downloadDisposition(name)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		disposition = d
+	}
+	originalType, gzipped := gzipPinType(c.UserContext(), cid)
+
+	// The body is streamed after the handler returns, so the upstream
+	// request must not be tied to the handler's context.
+	req, err := http.NewRequest("GET", gatewayURL(cid), nil)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	// Ranges of the gzipped bytes mean nothing to the client, and a range
+	// can't be checked against the CID.
+	if r := c.Get(fiber.HeaderRange); r != "" && !gzipped && !verifyDownload {
+		req.Header.Set(fiber.HeaderRange, r)
+	}
+
+	resp, err := gatewayClient.Do(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": err.Error()})
+	}
+	if verifyDownload && resp.StatusCode == http.StatusOK {
+		if err := verifyDownloadBody(c, cid, resp); err != nil {
+			logEvent("error", "gateway content failed verification", map[string]interface{}{
+				"request_id": requestIDFromContext(c.UserContext()),
+				"cid":        cid,
+				"error":      err.Error(),
+			})
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusPartialContent {
+		if gatewayCacheControl != "" {
+			c.Set(fiber.HeaderCacheControl, gatewayCacheControl)
+		}
+		if disposition != "" {
+			c.Set(fiber.HeaderContentDisposition, disposition)
+		}
+	}
+	if gzipped && resp.StatusCode == http.StatusOK {
+		return proxyGzipped(c, resp, originalType)
+	}
+
+	for _, h := range proxiedHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			c.Set(h, v)
+		}
+	}
+	c.Status(resp.StatusCode)
+
+	// fasthttp closes the body once it has been fully streamed.
+	c.Context().SetBodyStream(resp.Body, int(resp.ContentLength))
+	return nil
+}
+
+// proxyGzipped serves a gzipped pin as originalType, passing the bytes
+// through with Content-Encoding: gzip when the client accepts it and
+// decompressing them on the fly otherwise.
+func proxyGzipped(c *fiber.Ctx, resp *http.Response, originalType string) error {
+	c.Vary(fiber.HeaderAcceptEncoding)
+	c.Set(fiber.HeaderContentType, originalType)
+	for _, h := range []string{fiber.HeaderETag, fiber.HeaderLastModified} {
+		if v := resp.Header.Get(h); v != "" {
+			c.Set(h, v)
+		}
+	}
+
+	if c.Get(fiber.HeaderAcceptEncoding) != "" && c.AcceptsEncodings("gzip") == "gzip" {
+		c.Set(fiber.HeaderContentEncoding, "gzip")
+		c.Context().SetBodyStream(resp.Body, int(resp.ContentLength))
+		return nil
+	}
+
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "gateway returned invalid gzip content: " + err.Error()})
+	}
+	c.Context().SetBodyStream(&gunzipBody{Reader: zr, body: resp.Body}, -1)
+	return nil
+}
+
+// gunzipBody decompresses a gateway response, closing it along with the
+// reader.
+type gunzipBody struct {
+	*gzip.Reader
+	body io.Closer
+}
+
+func (b *gunzipBody) Close() error {
+	b.Reader.Close()
+	return b.body.Close()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"mime/multipart"
+	"strings"
+)
+
+// hashAlgorithms, from HASH_ALGORITHMS, lists the digests reported in an
+// upload's hashes, e.g. "sha256,md5,sha1" for legacy manifests. SHA-256 is
+// computed either way, since deduplication relies on it.
+var hashAlgorithms []string
+
+var hashConstructors = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+func parseHashAlgorithms(v string) ([]string, error) {
+	var algs []string
+	seen := map[string]bool{}
+	for _, alg := range strings.Split(v, ",") {
+		alg = strings.ToLower(strings.TrimSpace(alg))
+		if _, ok := hashConstructors[alg]; !ok {
+			return nil, fmt.Errorf("unknown algorithm %q; use md5, sha1, sha256 or sha512", alg)
+		}
+		if !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	return algs, nil
+}
+
+// fileDigests hashes the first size bytes of file through ReadAt, leaving
+// the read offset alone so wrappers counting Read calls (progress) are not
+// affected. Every algorithm in hashAlgorithms is fed from the same read.
+// It returns the SHA-256, the hashAlgorithms digests (nil when none are
+// configured) and how many bytes were actually hashed.
+func fileDigests(file multipart.File, size int64) (string, map[string]string, int64, error) {
+	sha := sha256.New()
+	hashes := map[string]hash.Hash{"sha256": sha}
+	writers := []io.Writer{sha}
+	for _, alg := range hashAlgorithms {
+		if _, ok := hashes[alg]; !ok {
+			hashes[alg] = hashConstructors[alg]()
+			writers = append(writers, hashes[alg])
+		}
+	}
+
+	n, err := io.Copy(io.MultiWriter(writers...), io.NewSectionReader(file, 0, size))
+	if err != nil {
+		return "", nil, n, err
+	}
+	var digests map[string]string
+	if len(hashAlgorithms) > 0 {
+		digests = make(map[string]string, len(hashAlgorithms))
+		for _, alg := range hashAlgorithms {
+			digests[alg] = hex.EncodeToString(hashes[alg].Sum(nil))
+		}
+	}
+	return hex.EncodeToString(sha.Sum(nil)), digests, n, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// idempotencyKeyTTL is how long a successful response is replayed for
+	// a repeated Idempotency-Key.
+	idempotencyKeyTTL       = 24 * time.Hour
+	idempotencyCacheSize    = 1000
+	maxIdempotencyKeyLength = 255
+)
+
+// idempotencyCache remembers the response sent for each Idempotency-Key,
+// dropping the oldest keys once it holds size entries.
+type idempotencyCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // front is most recently added
+	entries map[string]*list.Element
+}
+
+type idempotencyEntry struct {
+	key         string
+	expires     time.Time
+	done        bool // false while the first request is still running
+	status      int
+	contentType string
+	body        []byte
+}
+
+var uploadIdempotency = newIdempotencyCache(idempotencyCacheSize)
+
+func newIdempotencyCache(size int) *idempotencyCache {
+	return &idempotencyCache{size: size, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+// reserve claims key for a new request. If the key is already known it
+// instead returns a copy of its entry and true.
+func (ic *idempotencyCache) reserve(key string) (idempotencyEntry, bool) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	if el, ok := ic.entries[key]; ok {
+		entry := el.Value.(*idempotencyEntry)
+		if time.Now().Before(entry.expires) {
+			return *entry, true
+		}
+		ic.order.Remove(el)
+		delete(ic.entries, key)
+	}
+
+	ic.entries[key] = ic.order.PushFront(&idempotencyEntry{key: key, expires: time.Now().Add(idempotencyKeyTTL)})
+	for ic.order.Len() > ic.size {
+		oldest := ic.order.Back()
+		ic.order.Remove(oldest)
+		delete(ic.entries, oldest.Value.(*idempotencyEntry).key)
+	}
+	return idempotencyEntry{}, false
+}
+
+// complete stores the response for a reserved key.
+func (ic *idempotencyCache) complete(key string, status int, contentType string, body []byte) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	if el, ok := ic.entries[key]; ok {
+		entry := el.Value.(*idempotencyEntry)
+		entry.done, entry.status, entry.contentType, entry.body = true, status, contentType, body
+	}
+}
+
+// release forgets a reserved key whose request failed, so a retry runs.
+func (ic *idempotencyCache) release(key string) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	if el, ok := ic.entries[key]; ok && !el.Value.(*idempotencyEntry).done {
+		ic.order.Remove(el)
+		delete(ic.entries, key)
+	}
+}
+
+// idempotentUpload replays the earlier response when a client retries an
+// upload with the same Idempotency-Key, rather than pinning it again. Only
+// successful responses are kept; a repeat arriving while the first request
+// is still running gets 409.
+func idempotentUpload(c *fiber.Ctx) error {
+	clientKey := c.Get("Idempotency-Key")
+	if clientKey == "" {
+		return c.Next()
+	}
+	if len(clientKey) > maxIdempotencyKeyLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Idempotency-Key is too long"})
+	}
+	key := idempotencyScope(c) + ":" + clientKey
+
+	if entry, seen := uploadIdempotency.reserve(key); seen {
+		if !entry.done {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "a request with this Idempotency-Key is still in progress"})
+		}
+		c.Set("Idempotent-Replayed", "true")
+		c.Set(fiber.HeaderContentType, entry.contentType)
+		return c.Status(entry.status).Send(entry.body)
+	}
+
+	err := c.Next()
+	status := c.Response().StatusCode()
+	if err != nil || status < 200 || status >= 300 {
+		uploadIdempotency.release(key)
+		return err
+	}
+	body := append([]byte(nil), c.Response().Body()...)
+	uploadIdempotency.complete(key, status, string(c.Response().Header.ContentType()), body)
+	return nil
+}
+
+// idempotencyScope identifies who sent the request, so one caller's
+// Idempotency-Key never replays another's response. Credentials are hashed
+// rather than kept in the cache.
+func idempotencyScope(c *fiber.Ctx) string {
+	h := sha256.New()
+	h.Write(c.Request().Header.Peek(fiber.HeaderAuthorization))
+	h.Write([]byte{0})
+	h.Write(c.Request().Header.Peek(tenantJWTHeader))
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestIdempotencyKeyScopedPerCaller(t *testing.T) {
+	old := uploadIdempotency
+	uploadIdempotency = newIdempotencyCache(idempotencyCacheSize)
+	t.Cleanup(func() { uploadIdempotency = old })
+
+	calls := 0
+	app := fiber.New()
+	app.Post("/upload", idempotentUpload, func(c *fiber.Ctx) error {
+		calls++
+		return c.SendString(strconv.Itoa(calls))
+	})
+
+	send := func(auth, jwt string) (string, bool) {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/upload", nil)
+		req.Header.Set("Idempotency-Key", "retry-1")
+		if auth != "" {
+			req.Header.Set(fiber.HeaderAuthorization, auth)
+		}
+		if jwt != "" {
+			req.Header.Set(tenantJWTHeader, jwt)
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body), resp.Header.Get("Idempotent-Replayed") == "true"
+	}
+
+	tests := []struct {
+		auth, jwt    string
+		wantBody     string
+		wantReplayed bool
+	}{
+		{"Bearer a", "", "1", false},
+		{"Bearer a", "", "1", true},
+		{"Bearer b", "", "2", false},
+		{"Bearer a", "tenant", "3", false},
+		{"Bearer a", "tenant", "3", true},
+	}
+	for i, tt := range tests {
+		body, replayed := send(tt.auth, tt.jwt)
+		if body != tt.wantBody || replayed != tt.wantReplayed {
+			t.Errorf("request %d (%q, %q): got (%s, replayed=%v), want (%s, replayed=%v)",
+				i, tt.auth, tt.jwt, body, replayed, tt.wantBody, tt.wantReplayed)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// publishHandler publishes a CID under the Kubo node's IPNS key, so a fixed
+// /ipns/ name can follow content that changes. Pinata doesn't publish IPNS
+// names, so this needs STORAGE_PROVIDER=kubo.
+func publishHandler(c *fiber.Ctx) error {
+	publisher, ok := pinner.(namePublisher)
+	if !ok {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "IPNS publishing requires STORAGE_PROVIDER=kubo; " + storageProvider + " does not support it"})
+	}
+
+	var req struct {
+		CID string `json:"cid"`
+	}
+	if err := decodeJSONBody(c, &req, maxJSONRequestBytes); err != nil {
+		return jsonBodyErrorResponse(c, err)
+	}
+	if req.CID == "" {
+		return jsonBodyErrorResponse(c, &requestFieldError{field: "cid", msg: `is required, e.g. {"cid":"..."}`})
+	}
+	if !isValidCID(req.CID) {
+		return jsonBodyErrorResponse(c, &requestFieldError{field: "cid", msg: "is not a valid CID"})
+	}
+
+	name, err := publisher.Publish(c.UserContext(), req.CID)
+	if err != nil {
+		return pinErrorResponse(c, fiber.StatusBadGateway, err)
+	}
+	body := fiber.Map{"cid": req.CID, "name": name}
+	if u := ipnsURL(name); u != "" {
+		body["ipns_url"] = u
+	}
+	return c.JSON(body)
+}
+
+// ipnsURL is the gateway URL resolving name, or "" when the gateway isn't
+// the usual .../ipfs/ path form an /ipns/ path can be derived from.
+func ipnsURL(name string) string {
+	if pinataGatewayDomain != "" {
+		return "https://" + pinataGatewayDomain + "/ipns/" + name
+	}
+	if base := strings.TrimSuffix(ipfsGateway, "ipfs/"); base != ipfsGateway {
+		return base + "ipns/" + name
+	}
+	return ""
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+const (
+	// isPinnedTimeout bounds the pinList lookup, so a slow Pinata answers
+	// /is-pinned with a 504 instead of holding the client.
+	isPinnedTimeout   = 5 * time.Second
+	isPinnedCacheTTL  = 30 * time.Second
+	isPinnedCacheSize = 1000
+)
+
+// pinStatusCache remembers recent /is-pinned answers for
+// isPinnedCacheTTL, dropping the oldest once it holds size entries.
+type pinStatusCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // front is most recently added
+	entries map[string]*list.Element
+}
+
+type pinStatusEntry struct {
+	cid     string
+	pinned  bool
+	expires time.Time
+}
+
+var pinStatuses = newPinStatusCache(isPinnedCacheSize)
+
+func newPinStatusCache(size int) *pinStatusCache {
+	return &pinStatusCache{size: size, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (pc *pinStatusCache) get(cid string) (pinned, ok bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	el, ok := pc.entries[cid]
+	if !ok {
+		return false, false
+	}
+	entry := el.Value.(*pinStatusEntry)
+	if time.Now().After(entry.expires) {
+		pc.order.Remove(el)
+		delete(pc.entries, cid)
+		return false, false
+	}
+	return entry.pinned, true
+}
+
+func (pc *pinStatusCache) add(cid string, pinned bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if el, ok := pc.entries[cid]; ok {
+		pc.order.Remove(el)
+	}
+	pc.entries[cid] = pc.order.PushFront(&pinStatusEntry{cid: cid, pinned: pinned, expires: time.Now().Add(isPinnedCacheTTL)})
+	for pc.order.Len() > pc.size {
+		oldest := pc.order.Back()
+		pc.order.Remove(oldest)
+		delete(pc.entries, oldest.Value.(*pinStatusEntry).cid)
+	}
+}
+
+// forget drops cid whenever this server pins or unpins it, so a cached
+// answer doesn't outlive the change.
+func (pc *pinStatusCache) forget(cid string) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if el, ok := pc.entries[cid]; ok {
+		pc.order.Remove(el)
+		delete(pc.entries, cid)
+	}
+}
+
+// isPinnedHandler reports whether cid is pinned, so a client can skip
+// uploading content the account already holds.
+func isPinnedHandler(c *fiber.Ctx) error {
+	cid := c.Params("cid")
+	if !isValidCID(cid) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid CID"})
+	}
+	if pinned, ok := pinStatuses.get(cid); ok {
+		return c.JSON(fiber.Map{"cid": cid, "pinned": pinned, "cached": true})
+	}
+	checker, ok := pinner.(pinChecker)
+	if !ok {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": fmt.Sprintf("%s cannot look up pins", storageProvider)})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), isPinnedTimeout)
+	defer cancel()
+	pinned, err := checker.IsPinned(ctx, cid)
+	if err != nil {
+		return pinErrorResponse(c, fiber.StatusBadGateway, err)
+	}
+	// Params point into the request buffer, which fiber reuses.
+	pinStatuses.add(utils.CopyString(cid), pinned)
+	return c.JSON(fiber.Map{"cid": cid, "pinned": pinned})
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultWorkerCount  = 4
+	defaultJobQueueSize = 100
+	// jobRetention is how long a finished job stays available to GET /jobs/:id.
+	jobRetention = time.Hour
+)
+
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobDone      = "done"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+)
+
+// workerCount, from WORKER_COUNT, is how many background uploads run at
+// once. spoolDir, from SPOOL_DIR, holds uploads waiting for a worker; empty
+// uses the system temp dir.
+var (
+	workerCount = defaultWorkerCount
+	spoolDir    string
+	jobQueue    = make(chan *uploadJob, defaultJobQueueSize)
+)
+
+var errJobQueueFull = errors.New("upload queue is full, retry later")
+
+// uploadJob is a background upload run by the worker pool. cancel stops
+// its context, which run passes to the pin.
+type uploadJob struct {
+	id     string
+	run    func(ctx context.Context) (uploadResult, error)
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	status string
+	result uploadResult
+}
+
+var (
+	jobsMu sync.Mutex
+	jobs   = map[string]*uploadJob{}
+)
+
+// startWorkers launches the pool draining jobQueue.
+func startWorkers() {
+	for i := 0; i < workerCount; i++ {
+		go func() {
+			for j := range jobQueue {
+				j.execute()
+			}
+		}()
+	}
+}
+
+// execute runs the job, even one cancelled while queued: run then fails
+// straight away and still cleans up after itself.
+func (j *uploadJob) execute() {
+	defer j.cancel()
+
+	j.mu.Lock()
+	if j.status == jobQueued {
+		j.status = jobRunning
+	}
+	j.mu.Unlock()
+
+	result, err := j.run(j.ctx)
+	j.mu.Lock()
+	j.result = result
+	switch {
+	case err == nil:
+		// A pin that landed despite a late cancel is still reported.
+		j.status = jobDone
+	case j.status != jobCancelled:
+		j.status = jobFailed
+		j.result.Error = err.Error()
+	}
+	j.mu.Unlock()
+
+	time.AfterFunc(jobRetention, func() {
+		jobsMu.Lock()
+		delete(jobs, j.id)
+		jobsMu.Unlock()
+	})
+}
+
+// finished reports whether the job has a final result.
+func (j *uploadJob) finished() bool {
+	return j.status == jobDone || j.status == jobFailed
+}
+
+// enqueueJob registers run as queued job id, failing fast instead of
+// blocking the request when the queue is full. The job's context carries
+// requestID and is cancelled with uploadsCtx when shutdown gives up
+// draining.
+func enqueueJob(id, requestID string, run func(ctx context.Context) (uploadResult, error)) (*uploadJob, error) {
+	// The request ID may point into the request's reused header buffer.
+	ctx := context.WithValue(uploadsCtx, requestIDKey, utils.CopyString(requestID))
+	ctx, cancel := context.WithCancel(ctx)
+	j := &uploadJob{id: id, run: run, ctx: ctx, cancel: cancel, status: jobQueued}
+
+	jobsMu.Lock()
+	jobs[j.id] = j
+	jobsMu.Unlock()
+
+	select {
+	case jobQueue <- j:
+		return j, nil
+	default:
+		jobsMu.Lock()
+		delete(jobs, j.id)
+		jobsMu.Unlock()
+		cancel()
+		return nil, errJobQueueFull
+	}
+}
+
+// spoolUpload copies file into spoolDir, since the request's multipart data
+// is released once the handler returns. The caller must remove the file.
+func spoolUpload(file io.Reader) (*os.File, error) {
+	spool, err := os.CreateTemp(spoolDir, "ipfs-upload-*")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(spool, file); err != nil {
+		spool.Close()
+		os.Remove(spool.Name())
+		return nil, err
+	}
+	return spool, nil
+}
+
+// enqueueUpload spools the file and queues its upload, answering 202 with
+// the job ID straight away.
+func enqueueUpload(c *fiber.Ctx, file multipart.File, fileHeader *multipart.FileHeader, opts uploadOptions) error {
+	spool, err := spoolUpload(file)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	header := &multipart.FileHeader{Filename: fileHeader.Filename, Size: fileHeader.Size, Header: fileHeader.Header}
+
+	j, err := enqueueJob(uuid.NewString(), requestIDFromContext(c.Context()), func(ctx context.Context) (uploadResult, error) {
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+
+		result, err := uploadToIPFS(ctx, spool, header, opts)
+		if err != nil {
+			return uploadResult{Filename: header.Filename}, err
+		}
+		return result, nil
+	})
+	if err != nil {
+		spool.Close()
+		os.Remove(spool.Name())
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"job_id":     j.id,
+		"status":     jobQueued,
+		"status_url": "/jobs/" + j.id,
+	})
+}
+
+// jobHandler reports a job's status, with the upload result once it has
+// finished.
+func jobHandler(c *fiber.Ctx) error {
+	jobsMu.Lock()
+	j := jobs[c.Params("id")]
+	jobsMu.Unlock()
+	if j == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "unknown job id"})
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	resp := fiber.Map{"job_id": j.id, "status": j.status}
+	if j.finished() {
+		resp["result"] = j.result
+	}
+	return c.JSON(resp)
+}
+
+// cancelJobHandler cancels a queued or running job so it never reaches, or
+// stops talking to, the pinning service. A job that already finished is
+// left alone and its result returned instead.
+func cancelJobHandler(c *fiber.Ctx) error {
+	jobsMu.Lock()
+	j := jobs[c.Params("id")]
+	jobsMu.Unlock()
+	if j == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "unknown job id"})
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.finished() {
+		return c.JSON(fiber.Map{"job_id": j.id, "status": j.status, "result": j.result})
+	}
+	j.status = jobCancelled
+	j.cancel()
+	return c.JSON(fiber.Map{"job_id": j.id, "status": j.status})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxJSONRequestBytes caps the small JSON request objects of /upload-url
+// and /pin-by-hash.
+const maxJSONRequestBytes = 64 << 10
+
+var errJSONBodyTooLarge = errors.New("request body is too large")
+
+// requestFieldError names the JSON field that made a request invalid.
+type requestFieldError struct {
+	field string
+	msg   string
+}
+
+func (e *requestFieldError) Error() string {
+	return e.field + " " + e.msg
+}
+
+// decodeJSONBody strictly decodes the request body into dst: it must be a
+// single JSON value of at most limit bytes with no fields dst doesn't
+// declare.
+func decodeJSONBody(c *fiber.Ctx, dst interface{}, limit int) error {
+	body := c.Body()
+	if len(body) > limit {
+		return errJSONBodyTooLarge
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.Is(err, io.EOF):
+			return errors.New("request body is empty; expected a JSON object")
+		case errors.As(err, &syntaxErr):
+			return fmt.Errorf("request body is not valid JSON (at byte %d)", syntaxErr.Offset)
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return errors.New("request body is truncated JSON")
+		case errors.As(err, &typeErr) && typeErr.Field != "":
+			return &requestFieldError{field: typeErr.Field, msg: "must be a JSON " + typeErr.Type.Kind().String()}
+		case errors.As(err, &typeErr):
+			return errors.New("request body must be a JSON object")
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+			return &requestFieldError{field: field, msg: "is not a known field"}
+		default:
+			return err
+		}
+	}
+	// dec.More would miss stray closing tokens such as {"a":1}}.
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		return errors.New("request body must contain a single JSON object")
+	}
+	return nil
+}
+
+// jsonBodyErrorResponse answers a failed decodeJSONBody or a missing field,
+// naming the field when there is one.
+func jsonBodyErrorResponse(c *fiber.Ctx, err error) error {
+	if errors.Is(err, errJSONBodyTooLarge) {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": err.Error()})
+	}
+	body := fiber.Map{"error": err.Error()}
+	var fieldErr *requestFieldError
+	if errors.As(err, &fieldErr) {
+		body["field"] = fieldErr.field
+	}
+	return c.Status(fiber.StatusBadRequest).JSON(body)
+}
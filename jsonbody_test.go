@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestDecodeJSONBodyRejectsTrailingData(t *testing.T) {
+	tests := []struct {
+		body    string
+		wantErr bool
+	}{
+		{`{"url":"https://example.com"}`, false},
+		{"{\"url\":\"https://example.com\"}\n  ", false},
+		{`{"url":"a"}}`, true},
+		{`{"url":"a"}]`, true},
+		{`{"url":"a"}{"url":"b"}`, true},
+		{`{"url":"a"} 1`, true},
+	}
+	for _, tt := range tests {
+		var decodeErr error
+		app := fiber.New()
+		app.Post("/", func(c *fiber.Ctx) error {
+			var req struct {
+				URL string `json:"url"`
+			}
+			decodeErr = decodeJSONBody(c, &req, maxJSONRequestBytes)
+			return nil
+		})
+		resp, err := app.Test(httptest.NewRequest("POST", "/", strings.NewReader(tt.body)), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if (decodeErr != nil) != tt.wantErr {
+			t.Errorf("%q: err = %v, want error %v", tt.body, decodeErr, tt.wantErr)
+		}
+	}
+}
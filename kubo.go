@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"ipfs-fiber-uploader/pinata"
+)
+
+const defaultKuboAPIURL = "http://localhost:5001"
+
+// kuboAPIURL is the Kubo RPC endpoint, configurable via IPFS_API_URL.
+var kuboAPIURL = defaultKuboAPIURL
+
+// KuboPinner adds and pins content on a local Kubo (go-ipfs) daemon.
+type KuboPinner struct {
+	apiURL     string
+	httpClient *http.Client
+}
+
+func (k *KuboPinner) Pin(ctx context.Context, file io.ReadSeeker, name string) (string, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		part, err := writer.CreateFormFile("file", name)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if _, err := io.Copy(part, file); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(writer.Close())
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", k.apiURL+"/api/v0/add?pin=true", pr)
+	if err != nil {
+		pr.CloseWithError(err)
+		<-done
+		return "", err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, err := k.httpClient.Do(req)
+	// Wait for the writer goroutine to stop reading before returning, as
+	// the caller closes the file once Pin does.
+	pr.Close()
+	<-done
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("kubo error: %s", strings.TrimSpace(string(body)))
+	}
+
+	// /api/v0/add streams one JSON object per added entry; for a single
+	// file the last line describes it.
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	var added struct {
+		Hash string `json:"Hash"`
+	}
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &added); err != nil {
+		return "", err
+	}
+	if added.Hash == "" {
+		return "", fmt.Errorf("kubo returned no hash: %s", string(body))
+	}
+	return added.Hash, nil
+}
+
+func (k *KuboPinner) Unpin(ctx context.Context, cid string) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", k.apiURL+"/api/v0/pin/rm?arg="+url.QueryEscape(cid), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := k.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		msg := strings.TrimSpace(string(body))
+		if strings.Contains(msg, "not pinned") {
+			return fmt.Errorf("kubo error: %s: %w", msg, errNotPinned)
+		}
+		return fmt.Errorf("kubo error: %s", msg)
+	}
+	return nil
+}
+
+// PinJSON adds content as a file. Kubo keeps no pin metadata, so metadata
+// is dropped.
+func (k *KuboPinner) PinJSON(ctx context.Context, content json.RawMessage, metadata pinata.Metadata) (string, error) {
+	return k.Pin(ctx, bytes.NewReader(content), "content.json")
+}
+
+// CheckHealth asks the daemon for its version, which fails when the RPC
+// endpoint is unreachable.
+func (k *KuboPinner) CheckHealth(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", k.apiURL+"/api/v0/version", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := k.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("kubo error: %s", strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// Publish points the node's own key (self) at cid and returns the IPNS name
+// it publishes under.
+func (k *KuboPinner) Publish(ctx context.Context, cid string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", k.apiURL+"/api/v0/name/publish?arg="+url.QueryEscape("/ipfs/"+cid), nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := k.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("kubo error: %s", strings.TrimSpace(string(body)))
+	}
+
+	var published struct {
+		Name string `json:"Name"`
+	}
+	if err := json.Unmarshal(body, &published); err != nil {
+		return "", err
+	}
+	if published.Name == "" {
+		return "", fmt.Errorf("kubo returned no IPNS name: %s", string(body))
+	}
+	return published.Name, nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// zeroFile is a ReadSeeker of size zero bytes, standing in for a large
+// upload without holding it in memory.
+type zeroFile struct {
+	size, off int64
+}
+
+func (z *zeroFile) Read(p []byte) (int, error) {
+	if z.off >= z.size {
+		return 0, io.EOF
+	}
+	if rest := z.size - z.off; int64(len(p)) > rest {
+		p = p[:rest]
+	}
+	for i := range p {
+		p[i] = 0
+	}
+	z.off += int64(len(p))
+	return len(p), nil
+}
+
+func (z *zeroFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		z.off = offset
+	case io.SeekCurrent:
+		z.off += offset
+	case io.SeekEnd:
+		z.off = z.size + offset
+	}
+	return z.off, nil
+}
+
+// waitForGoroutines polls until at most n goroutines are running, as
+// goroutines that were told to stop may take a moment to exit.
+func waitForGoroutines(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > n {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			t.Fatalf("%d goroutines running, want at most %d:\n%s", runtime.NumGoroutine(), n, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestKuboPin(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v0/add" || r.URL.Query().Get("pin") != "true" {
+			t.Errorf("request = %s", r.URL)
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			t.Fatalf("reading file part: %v", err)
+		}
+		body, _ := io.ReadAll(file)
+		if string(body) != "hello" {
+			t.Errorf("file part = %q, want hello", body)
+		}
+		io.WriteString(w, `{"Name":"hello.txt","Hash":"QmTest"}`+"\n")
+	}))
+	defer srv.Close()
+
+	k := &KuboPinner{apiURL: srv.URL, httpClient: srv.Client()}
+	cid, err := k.Pin(context.Background(), strings.NewReader("hello"), "hello.txt")
+	if err != nil || cid != "QmTest" {
+		t.Fatalf("Pin = %q, %v; want QmTest", cid, err)
+	}
+}
+
+func TestKuboPinCancelStopsBodyWriter(t *testing.T) {
+	reading, release, handled := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(handled)
+		io.CopyN(io.Discard, r.Body, 1<<20)
+		close(reading)
+		<-release
+	}))
+	defer srv.Close()
+
+	transport := &http.Transport{}
+	k := &KuboPinner{apiURL: srv.URL, httpClient: &http.Client{Transport: transport}}
+	baseline := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-reading
+		cancel()
+	}()
+	if _, err := k.Pin(ctx, &zeroFile{size: 1 << 30}, "big.bin"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+
+	close(release)
+	<-handled
+	transport.CloseIdleConnections()
+	srv.CloseClientConnections()
+	waitForGoroutines(t, baseline)
+}
+
+func TestUnpinBatchWithKubo(t *testing.T) {
+	const (
+		pinned    = testCID
+		notPinned = "QmfDmsHTywy6L9Ne5RXsj5YumDedfBLMvCvmaxjBoe6w4d"
+		broken    = "QmQLd9KEkw5eLKfr9VwfthiWbuqa9LXhRchWqD4kRPPWEf"
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("arg") {
+		case pinned:
+			io.WriteString(w, `{"Pins":["`+pinned+`"]}`)
+		case notPinned:
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `{"Message":"not pinned or pinned indirectly","Code":0,"Type":"error"}`)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `{"Message":"repo is locked","Code":0,"Type":"error"}`)
+		}
+	}))
+	defer srv.Close()
+	oldPinner, oldDedup := pinner, uploadDedup
+	pinner, uploadDedup = &KuboPinner{apiURL: srv.URL, httpClient: srv.Client()}, newDedupCache(defaultDedupCacheSize)
+	t.Cleanup(func() { pinner, uploadDedup = oldPinner, oldDedup })
+	uploadDedup.add("sum", pinned)
+
+	app := fiber.New()
+	app.Post("/unpin-batch", unpinBatchHandler)
+	req := httptest.NewRequest("POST", "/unpin-batch", strings.NewReader(`{"cids":["`+pinned+`","`+notPinned+`","`+broken+`"]}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Results []unpinBatchResult `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusMultiStatus {
+		t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusMultiStatus)
+	}
+	want := map[string]string{pinned: "unpinned", notPinned: "not_pinned", broken: "failed"}
+	for _, r := range body.Results {
+		if r.Status != want[r.CID] {
+			t.Errorf("%s: status = %q, want %q", r.CID, r.Status, want[r.CID])
+		}
+	}
+	if _, ok := uploadDedup.get("sum"); ok {
+		t.Error("dedup cache still offers the unpinned CID")
+	}
+}
+
+func TestKuboBackedEndpoints(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v0/version":
+			io.WriteString(w, `{"Version":"0.29.0"}`)
+		case "/api/v0/add":
+			file, _, err := r.FormFile("file")
+			if err != nil {
+				t.Errorf("reading file part: %v", err)
+				return
+			}
+			body, _ := io.ReadAll(file)
+			if string(body) != `{"a":1}` {
+				t.Errorf("pinned %q, want the JSON body", body)
+			}
+			io.WriteString(w, `{"Name":"content.json","Hash":"`+testCID+`"}`+"\n")
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+	oldPinner, oldProvider := pinner, storageProvider
+	pinner, storageProvider = &KuboPinner{apiURL: srv.URL, httpClient: srv.Client()}, "kubo"
+	t.Cleanup(func() { pinner, storageProvider = oldPinner, oldProvider })
+
+	app := fiber.New()
+	app.Get("/health", healthHandler)
+	app.Post("/upload-json", uploadJSONHandler)
+	app.Post("/pin-by-hash", pinByHashHandler)
+	app.Get("/pins", listPinsHandler)
+
+	tests := []struct {
+		method, path, body string
+		wantStatus         int
+		wantField, want    string
+	}{
+		{"GET", "/health?deep=true", "", fiber.StatusOK, "kubo", "ok"},
+		{"POST", "/upload-json", `{"a":1}`, fiber.StatusOK, "cid", testCID},
+		{"POST", "/pin-by-hash", `{"cid":"` + testCID + `"}`, fiber.StatusNotImplemented, "", ""},
+		{"GET", "/pins", "", fiber.StatusNotImplemented, "", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("%s %s: status = %d, want %d (%v)", tt.method, tt.path, resp.StatusCode, tt.wantStatus, body)
+		}
+		if tt.wantField != "" && body[tt.wantField] != tt.want {
+			t.Errorf("%s %s: %s = %v, want %s", tt.method, tt.path, tt.wantField, body[tt.wantField], tt.want)
+		}
+	}
+}
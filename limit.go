@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+const (
+	defaultMaxConcurrentUploads = 10
+	defaultMaxQueuedUploads     = 100
+	defaultQueueTimeout         = 5 * time.Second
+	defaultRateWindow           = time.Minute
+	defaultMaxFilesPerRequest   = 20
+)
+
+// rateLimit is how many upload requests one client IP may make per
+// rateWindow, from RATE_LIMIT and RATE_WINDOW. Zero disables rate limiting.
+var (
+	rateLimit  int
+	rateWindow = defaultRateWindow
+)
+
+// trustedProxies lists the proxies (IPs or CIDRs, from TRUSTED_PROXIES)
+// whose proxyHeader is believed when resolving the client IP.
+var (
+	trustedProxies []string
+	proxyHeader    = fiber.HeaderXForwardedFor
+)
+
+// maxFilesPerRequest caps how many files one multi-file upload may carry,
+// from MAX_FILES_PER_REQUEST.
+var maxFilesPerRequest = defaultMaxFilesPerRequest
+
+// maxTotalUploadBytes, from MAX_TOTAL_UPLOAD_BYTES, caps the combined size
+// of the files in one multi-file or directory upload. Zero leaves only the
+// per-file limit.
+var maxTotalUploadBytes int64
+
+// uploadSlots is a counting semaphore bounding how many Pinata uploads run
+// at once. It is sized from MAX_CONCURRENT_UPLOADS in loadEnv.
+var uploadSlots = make(chan struct{}, defaultMaxConcurrentUploads)
+
+// Requests that find every slot taken wait in a queue of at most
+// maxQueuedUploads (MAX_QUEUED_UPLOADS) for up to queueTimeout
+// (QUEUE_TIMEOUT). queuedUploads is the current depth.
+var (
+	maxQueuedUploads = defaultMaxQueuedUploads
+	queueTimeout     = defaultQueueTimeout
+	queuedUploads    int64 // accessed atomically
+)
+
+var (
+	errUploadQueueFull    = errors.New("upload queue is full, retry later")
+	errUploadQueueTimeout = errors.New("too many concurrent uploads, retry later")
+)
+
+// limitConcurrentUploads holds a slot for the duration of the handler. When
+// none is free the request queues for one; a full queue or a wait longer
+// than queueTimeout tells the client to retry later.
+func limitConcurrentUploads(c *fiber.Ctx) error {
+	release, err := acquireUploadSlot()
+	if err != nil {
+		return uploadSlotErrorResponse(c, err)
+	}
+	defer release()
+
+	return c.Next()
+}
+
+// acquireUploadSlot takes a slot for handlers that only pin on some
+// requests, such as the tus PATCH completing an upload. release must be
+// called once the pin is done.
+func acquireUploadSlot() (release func(), err error) {
+	select {
+	case uploadSlots <- struct{}{}:
+	default:
+		if err := waitForUploadSlot(); err != nil {
+			return nil, err
+		}
+	}
+	return func() { <-uploadSlots }, nil
+}
+
+func uploadSlotErrorResponse(c *fiber.Ctx, err error) error {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(queueTimeout.Seconds())+1))
+	return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": err.Error()})
+}
+
+// waitForUploadSlot queues for a slot, failing at once when the queue is
+// already full.
+func waitForUploadSlot() error {
+	if atomic.AddInt64(&queuedUploads, 1) > int64(maxQueuedUploads) {
+		atomic.AddInt64(&queuedUploads, -1)
+		return errUploadQueueFull
+	}
+	defer atomic.AddInt64(&queuedUploads, -1)
+
+	timer := time.NewTimer(queueTimeout)
+	defer timer.Stop()
+	select {
+	case uploadSlots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return errUploadQueueTimeout
+	}
+}
+
+// proxyHeaderIfTrusted returns the header to read client IPs from, or ""
+// to use the connection's address when no trusted proxies are configured.
+func proxyHeaderIfTrusted() string {
+	if len(trustedProxies) == 0 {
+		return ""
+	}
+	return proxyHeader
+}
+
+// uploadRateLimiter limits upload requests per client IP. c.IP() honours
+// proxyHeader only for requests coming from trustedProxies. The limiter
+// sets Retry-After itself before LimitReached runs.
+func uploadRateLimiter() fiber.Handler {
+	if rateLimit <= 0 {
+		return func(c *fiber.Ctx) error { return c.Next() }
+	}
+	return limiter.New(limiter.Config{
+		Max:        rateLimit,
+		Expiration: rateWindow,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return c.IP()
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "rate limit exceeded, retry later"})
+		},
+	})
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+)
+
+// requestIDKey is the Locals key requestid stores the ID under. Fiber keeps
+// Locals on the fasthttp request context, so it can also be read back from
+// the context.Context handed to Pinata calls.
+const requestIDKey = "requestid"
+
+// requestLogger emits one JSON line per request with method, path, status,
+// latency and the request ID.
+func requestLogger() fiber.Handler {
+	return logger.New(logger.Config{
+		// Access lines are info; warn and error keep only failures logged
+		// through logEvent.
+		Next: func(c *fiber.Ctx) bool {
+			return logLevel > levelInfo
+		},
+		Format:     `{"time":"${time}","level":"info","request_id":"${locals:requestid}","method":"${method}","path":${json_path},"status":${status},"latency_ms":${latency},"error":${json_error}}` + "\n",
+		TimeFormat: time.RFC3339,
+		Output:     os.Stdout,
+		CustomTags: map[string]logger.LogFunc{
+			"json_path": func(output logger.Buffer, c *fiber.Ctx, data *logger.Data, extraParam string) (int, error) {
+				return writeJSON(output, c.Path())
+			},
+			// Overriding the built-in latency tag keeps start/stop timing
+			// enabled while rendering it as a plain number of milliseconds.
+			logger.TagLatency: func(output logger.Buffer, c *fiber.Ctx, data *logger.Data, extraParam string) (int, error) {
+				return writeJSON(output, data.Stop.Sub(data.Start).Milliseconds())
+			},
+			"json_error": func(output logger.Buffer, c *fiber.Ctx, data *logger.Data, extraParam string) (int, error) {
+				if data.ChainErr == nil {
+					return output.WriteString("null")
+				}
+				return writeJSON(output, data.ChainErr.Error())
+			},
+		},
+	})
+}
+
+func requestIDMiddleware() fiber.Handler {
+	return requestid.New(requestid.Config{ContextKey: requestIDKey})
+}
+
+func writeJSON(output logger.Buffer, v interface{}) (int, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return 0, err
+	}
+	return output.Write(b)
+}
+
+// requestIDFromContext returns the request ID attached by the requestid
+// middleware, or "" for contexts that didn't originate from a request.
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// Log levels in increasing severity; logEvent drops entries below
+// logLevel, set from LOG_LEVEL.
+const (
+	levelDebug = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var logLevels = map[string]int{
+	"debug": levelDebug,
+	"info":  levelInfo,
+	"warn":  levelWarn,
+	"error": levelError,
+}
+
+var logLevel = levelInfo
+
+// parseLogLevel accepts debug, info, warn or error in any case.
+func parseLogLevel(v string) (int, error) {
+	level, ok := logLevels[strings.ToLower(v)]
+	if !ok {
+		return 0, errors.New("must be debug, info, warn or error")
+	}
+	return level, nil
+}
+
+// logEnabled reports whether entries of level are written.
+func logEnabled(level string) bool {
+	n, ok := logLevels[level]
+	return !ok || n >= logLevel
+}
+
+// logEvent writes a single structured log line to stderr.
+func logEvent(level, msg string, fields map[string]interface{}) {
+	if !logEnabled(level) {
+		return
+	}
+	entry := map[string]interface{}{
+		"time":  time.Now().Format(time.RFC3339),
+		"level": level,
+		"msg":   msg,
+	}
+	for k, v := range fields {
+		entry[k] = v
+	}
+	json.NewEncoder(os.Stderr).Encode(entry)
+}
@@ -1,192 +1,1521 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
+	"context"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
+	"mime"
 	"mime/multipart"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
-	
 
+	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/joho/godotenv"
+
+	"ipfs-fiber-uploader/pinata"
 )
 
-type PinataResponse struct {
-	IpfsHash string `json:"IpfsHash"`
-}
+const defaultMaxUploadBytes = 50 << 20 // 50MB
+
+const (
+	defaultPort             = "3000"
+	defaultIPFSGateway      = "https://ipfs.io/ipfs/"
+	defaultPinataMaxRetries = 3
+	defaultPinataTimeout    = 60 * time.Second
+)
 
-func loadEnv() {
+var (
+	maxUploadBytes   int64 = defaultMaxUploadBytes
+	pinataMaxRetries       = defaultPinataMaxRetries
+	pinataTimeout          = defaultPinataTimeout
+	maxRetryDelay          = pinata.DefaultMaxRetryDelay
+	ipfsGateway            = defaultIPFSGateway
+	port                   = defaultPort
+	serverURL              = "http://localhost:" + defaultPort
+	allowedOrigins         = "*"
+	verifyCID        bool
+	// cidVersion is Pinata's cidVersion option from CID_VERSION; nil keeps
+	// Pinata's default.
+	cidVersion *int
+	// pinataGatewayDomain and pinataGatewayToken, when set, point returned
+	// URLs at a Pinata dedicated gateway instead of ipfsGateway.
+	pinataGatewayDomain string
+	pinataGatewayToken  string
+)
+
+func loadEnv(configPath string) {
+	// Containers usually inject settings straight into the environment, so
+	// a missing .env is fine; validateConfig catches anything required.
 	err := godotenv.Load()
+	if errors.Is(err, os.ErrNotExist) {
+		log.Println("ℹ️  No .env file found; reading settings from the environment")
+	} else if err != nil {
+		log.Fatalf("❌ Error loading .env file: %v", err)
+	}
+
+	config, err = loadConfig(configPath)
 	if err != nil {
-		log.Fatal("❌ Error loading .env file")
+		log.Fatalf("❌ Invalid config file: %v", err)
 	}
-}
 
-func uploadToIPFS(file multipart.File, fileHeader *multipart.FileHeader) (string, error) {
-	pinataAPIKey := os.Getenv("PINATA_API_KEY")
-	pinataSecret := os.Getenv("PINATA_SECRET_API_KEY")
+	if v := config.MaxUploadBytes; v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			log.Fatalf("❌ Invalid MAX_UPLOAD_BYTES %q: must be a positive integer", v)
+		}
+		maxUploadBytes = n
+	}
 
-	var requestBody bytes.Buffer
-	writer := multipart.NewWriter(&requestBody)
+	if v := config.PinataMaxRetries; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			log.Fatalf("❌ Invalid PINATA_MAX_RETRIES %q: must be a non-negative integer", v)
+		}
+		pinataMaxRetries = n
+	}
 
-	part, err := writer.CreateFormFile("file", fileHeader.Filename)
-	if err != nil {
-		return "", err
+	waitForPin = config.WaitForPin == "true"
+	if v := config.PinWaitTimeout; v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("❌ Invalid PIN_WAIT_TIMEOUT %q: must be a positive duration like 30s", v)
+		}
+		pinWaitTimeout = d
 	}
 
-	_, err = io.Copy(part, file)
-	if err != nil {
-		return "", err
+	if v := config.RequestTimeout; v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("❌ Invalid REQUEST_TIMEOUT %q: must be a positive duration like 2m", v)
+		}
+		requestTimeout = d
 	}
-	writer.Close()
 
-	req, err := http.NewRequest("POST", "https://api.pinata.cloud/pinning/pinFileToIPFS", &requestBody)
-	if err != nil {
-		return "", err
+	if v := config.MaxRetryDelay; v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			log.Fatalf("❌ Invalid MAX_RETRY_DELAY %q: must be a non-negative duration like 30s", v)
+		}
+		maxRetryDelay = d
 	}
 
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	req.Header.Set("pinata_api_key", pinataAPIKey)
-	req.Header.Set("pinata_secret_api_key", pinataSecret)
+	if v := config.PinataTimeout; v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("❌ Invalid PINATA_TIMEOUT %q: must be a positive duration like 60s", v)
+		}
+		pinataTimeout = d
+		fetchClient.Timeout = d
+		urlFetchClient.Timeout = d
+	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
+	if v := config.IPFSGateway; v != "" {
+		u, err := url.Parse(v)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			log.Fatalf("❌ Invalid IPFS_GATEWAY %q: must be an absolute http(s) URL", v)
+		}
+		if !strings.HasSuffix(v, "/") {
+			v += "/"
+		}
+		ipfsGateway = v
 	}
-	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(resp.Body)
+	switch v := config.GatewayCacheControl; v {
+	case "":
+	case "off":
+		gatewayCacheControl = ""
+	default:
+		gatewayCacheControl = v
+	}
 
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("pinata error: %s", string(body))
+	if v := config.GatewayByType; v != "" {
+		routes, err := parseGatewayRoutes(v)
+		if err != nil {
+			log.Fatalf("❌ Invalid GATEWAY_BY_TYPE: %v", err)
+		}
+		gatewaysByType = routes
 	}
 
-	var pinataRes PinataResponse
-	err = json.Unmarshal(body, &pinataRes)
-	if err != nil {
-		return "", err
+	pinataGatewayDomain = config.PinataGatewayDomain
+	pinataGatewayToken = config.PinataGatewayToken
+	if strings.Contains(pinataGatewayDomain, "/") {
+		log.Fatalf("❌ Invalid PINATA_GATEWAY_DOMAIN %q: must be a bare host like example.mypinata.cloud", pinataGatewayDomain)
+	}
+	if pinataGatewayToken != "" && pinataGatewayDomain == "" {
+		log.Fatalf("❌ PINATA_GATEWAY_TOKEN is set but PINATA_GATEWAY_DOMAIN is not")
 	}
 
-	return fmt.Sprintf("https://ipfs.io/ipfs/%s", pinataRes.IpfsHash), nil
-}
+	// REQUIRE_CUSTOM_GATEWAY keeps CIDs away from the public gateway: it
+	// must be replaced, and nothing may route back to it.
+	if config.RequireCustomGateway == "true" {
+		if config.IPFSGateway == "" && pinataGatewayDomain == "" {
+			log.Fatalf("❌ REQUIRE_CUSTOM_GATEWAY is set but neither IPFS_GATEWAY nor PINATA_GATEWAY_DOMAIN is configured")
+		}
+		if config.IPFSGateway != "" && isPublicGateway(ipfsGateway) {
+			log.Fatalf("❌ REQUIRE_CUSTOM_GATEWAY is set but IPFS_GATEWAY %q is the public ipfs.io gateway", ipfsGateway)
+		}
+		for _, r := range gatewaysByType {
+			if isPublicGateway(r.baseURL) {
+				log.Fatalf("❌ REQUIRE_CUSTOM_GATEWAY is set but GATEWAY_BY_TYPE routes %s to the public ipfs.io gateway", r.pattern)
+			}
+		}
+		if config.IPFSGateway == "" {
+			// Every URL goes through the dedicated gateway; drop the default.
+			ipfsGateway = ""
+		}
+	}
 
-func startFiberApp(wg *sync.WaitGroup) {
-	defer wg.Done()
-	app := fiber.New()
+	if v := config.EncryptionKey; v != "" {
+		key, err := hex.DecodeString(v)
+		if err != nil || len(key) != 32 {
+			log.Fatalf("❌ Invalid ENCRYPTION_KEY: must be 32 bytes encoded as 64 hex characters")
+		}
+		encryptionKey = key
+	}
 
-	app.Post("/upload", func(c *fiber.Ctx) error {
-		fileHeader, err := c.FormFile("file")
-		if err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "File missing"})
+	if v := config.Port; v != "" {
+		if n, err := strconv.Atoi(v); err != nil || n <= 0 || n > 65535 {
+			log.Fatalf("❌ Invalid PORT %q: must be between 1 and 65535", v)
+		}
+		port = v
+		serverURL = "http://localhost:" + port
+	}
+
+	if v := config.AllowedOrigins; v != "" {
+		origins := strings.Split(v, ",")
+		for i := range origins {
+			origins[i] = strings.TrimSpace(origins[i])
 		}
+		allowedOrigins = strings.Join(origins, ",")
+	}
+
+	verifyCID = config.VerifyCID == "true"
+	verifyDownload = config.VerifyDownload == "true"
+	stripEXIF = config.StripEXIF == "true"
+	generateThumbnails = config.GenerateThumbnails == "true"
 
-		file, err := fileHeader.Open()
+	if v := config.CIDVersion; v != "" {
+		n, err := parseCIDVersion(v)
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "File open failed"})
+			log.Fatalf("❌ Invalid CID_VERSION %q: must be 0 or 1", v)
+		}
+		cidVersion = &n
+	}
+	enableMetrics = config.EnableMetrics == "true"
+
+	if v := config.AllowedMIMETypes; v != "" {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				allowedMIMETypes = append(allowedMIMETypes, strings.ToLower(t))
+			}
+		}
+	}
+
+	if v := config.MaxConcurrentUploads; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("❌ Invalid MAX_CONCURRENT_UPLOADS %q: must be a positive integer", v)
+		}
+		uploadSlots = make(chan struct{}, n)
+	}
+
+	if v := config.MaxQueuedUploads; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			log.Fatalf("❌ Invalid MAX_QUEUED_UPLOADS %q: must be a non-negative integer", v)
+		}
+		maxQueuedUploads = n
+	}
+	if v := config.QueueTimeout; v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("❌ Invalid QUEUE_TIMEOUT %q: must be a positive duration like 5s", v)
+		}
+		queueTimeout = d
+	}
+
+	if v := config.MaxTotalUploadBytes; v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			log.Fatalf("❌ Invalid MAX_TOTAL_UPLOAD_BYTES %q: must be a positive integer", v)
 		}
-		defer file.Close()
+		maxTotalUploadBytes = n
+	}
 
-		ipfsURL, err := uploadToIPFS(file, fileHeader)
+	if v := config.HashAlgorithms; v != "" {
+		algs, err := parseHashAlgorithms(v)
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+			log.Fatalf("❌ Invalid HASH_ALGORITHMS %q: %v", v, err)
 		}
+		hashAlgorithms = algs
+	}
 
-		return c.JSON(fiber.Map{
-			"ipfs_url": ipfsURL,
-		})
-	})
+	if v := config.PinNameTemplate; v != "" {
+		if err := parsePinNameTemplate(v); err != nil {
+			log.Fatalf("❌ Invalid PIN_NAME_TEMPLATE %q: %v", v, err)
+		}
+		pinNameTemplate = v
+	}
 
-	fmt.Println("🚀 Server started at http://localhost:3000")
-	log.Fatal(app.Listen(":3000"))
-}
+	if v := config.MaxArchiveEntries; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("❌ Invalid MAX_ARCHIVE_ENTRIES %q: must be a positive integer", v)
+		}
+		maxArchiveEntries = n
+	}
+	if v := config.MaxArchiveBytes; v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			log.Fatalf("❌ Invalid MAX_ARCHIVE_BYTES %q: must be a positive integer", v)
+		}
+		maxArchiveBytes = n
+	}
 
-func cliUpload() {
-	reader := bufio.NewReader(os.Stdin)
-	for {
-		fmt.Print("Enter the path of the image file (or 'exit' to quit): ")
-		input, _ := reader.ReadString('\n')
-		input = strings.TrimSpace(input)
-		if input == "exit" {
-			fmt.Println("Exiting CLI uploader.")
-			break
+	if v := config.MaxFilesPerRequest; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("❌ Invalid MAX_FILES_PER_REQUEST %q: must be a positive integer", v)
 		}
+		maxFilesPerRequest = n
+	}
 
-		file, err := os.Open(input)
+	apiToken = config.APIToken
+
+	if v := config.ClamAVAddress; v != "" {
+		if _, _, err := net.SplitHostPort(v); err != nil {
+			log.Fatalf("❌ Invalid CLAMAV_ADDRESS %q: must be host:port", v)
+		}
+		clamavAddress = v
+	}
+
+	if v := config.WebhookURL; v != "" {
+		u, err := url.Parse(v)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			log.Fatalf("❌ Invalid WEBHOOK_URL %q: must be an absolute http(s) URL", v)
+		}
+		webhookURL = v
+	}
+	webhookSecret = config.WebhookSecret
+
+	if v := config.RateLimit; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			log.Fatalf("❌ Invalid RATE_LIMIT %q: must be a non-negative integer", v)
+		}
+		rateLimit = n
+	}
+
+	if v := config.RateWindow; v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("❌ Invalid RATE_WINDOW %q: must be a positive duration like 1m", v)
+		}
+		rateWindow = d
+	}
+
+	if v := config.TrustedProxies; v != "" {
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				trustedProxies = append(trustedProxies, p)
+			}
+		}
+	}
+	if v := config.ProxyHeader; v != "" {
+		proxyHeader = v
+	}
+
+	if v := config.WorkerCount; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("❌ Invalid WORKER_COUNT %q: must be a positive integer", v)
+		}
+		workerCount = n
+	}
+
+	if v := config.SpoolDir; v != "" {
+		if info, err := os.Stat(v); err != nil || !info.IsDir() {
+			log.Fatalf("❌ Invalid SPOOL_DIR %q: must be an existing directory", v)
+		}
+		spoolDir = v
+	}
+
+	if v := config.CompressionLevel; v != "" {
+		level, err := parseCompressionLevel(v)
 		if err != nil {
-			fmt.Println("Error opening file:", err)
-			continue
+			log.Fatalf("❌ Invalid COMPRESSION_LEVEL %q: %v", v, err)
+		}
+		compressionLevel = level
+	}
+
+	if v := config.InlineThreshold; v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			log.Fatalf("❌ Invalid INLINE_THRESHOLD %q: must be a non-negative number of bytes", v)
+		}
+		inlineThreshold = n
+	}
+	uploadTmpDir = config.UploadTmpDir
+
+	if v := config.DedupCacheSize; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			log.Fatalf("❌ Invalid DEDUP_CACHE_SIZE %q: must be a non-negative integer", v)
 		}
+		uploadDedup = newDedupCache(n)
+	}
 
-		body := &bytes.Buffer{}
-		writer := multipart.NewWriter(body)
+	tlsCertFile, tlsKeyFile = config.TLSCertFile, config.TLSKeyFile
+	if (tlsCertFile == "") != (tlsKeyFile == "") {
+		log.Fatalf("❌ TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	tlsAutoDomain = config.TLSAutoDomain
+	if tlsAutoDomain != "" && tlsCertFile != "" {
+		log.Fatalf("❌ TLS_AUTO_DOMAIN cannot be combined with TLS_CERT_FILE/TLS_KEY_FILE")
+	}
+	if v := config.TLSCacheDir; v != "" {
+		tlsCacheDir = v
+	}
+	if tlsEnabled() {
+		serverURL = "https://localhost:" + port
+	}
 
-		part, err := writer.CreateFormFile("file", filepath.Base(input))
+	if v := config.LogLevel; v != "" {
+		level, err := parseLogLevel(v)
 		if err != nil {
-			fmt.Println("Error creating form file:", err)
-			file.Close()
-			continue
+			log.Fatalf("❌ Invalid LOG_LEVEL %q: %v", v, err)
+		}
+		logLevel = level
+	}
+	if v := config.DebugCaptureDir; v != "" {
+		if err := os.MkdirAll(v, 0o700); err != nil {
+			log.Fatalf("❌ Invalid DEBUG_CAPTURE_DIR %q: %v", v, err)
+		}
+		debugCaptureDir = v
+	}
+
+	if v := config.ServerURL; v != "" {
+		serverURL = strings.TrimSuffix(v, "/")
+	}
+
+	pinataOptions = []pinata.Option{
+		pinata.WithHTTPClient(&http.Client{Timeout: pinataTimeout, Transport: &pinataTraceTransport{base: http.DefaultTransport}}),
+		pinata.WithMaxRetries(pinataMaxRetries),
+		pinata.WithMaxRetryDelay(maxRetryDelay),
+	}
+	if v := config.PinataJWT; v != "" {
+		pinataOptions = append(pinataOptions, pinata.WithJWT(v))
+	}
+	if v := config.PinataAPIURL; v != "" {
+		if u, err := url.Parse(v); err != nil || u.Scheme == "" || u.Host == "" {
+			log.Fatalf("❌ Invalid PINATA_API_URL %q: must be an absolute URL", v)
 		}
+		pinataOptions = append(pinataOptions, pinata.WithBaseURL(v))
+	}
+	keys, err := parseCredentialList(config.PinataAPIKey)
+	if err != nil {
+		log.Fatalf("❌ Invalid PINATA_API_KEY: %v", err)
+	}
+	secrets, err := parseCredentialList(config.PinataSecretAPIKey)
+	if err != nil {
+		log.Fatalf("❌ Invalid PINATA_SECRET_API_KEY: %v", err)
+	}
+	if len(keys) != len(secrets) {
+		log.Fatalf("❌ PINATA_API_KEY lists %d keys but PINATA_SECRET_API_KEY lists %d secrets", len(keys), len(secrets))
+	}
+	pinataClients = newPinataClients(keys, secrets, config.PinataJWT != "")
+	pinataClient = pinataClients[0]
+
+	if v := config.IPFSAPIURL; v != "" {
+		if u, err := url.Parse(v); err != nil || u.Scheme == "" || u.Host == "" {
+			log.Fatalf("❌ Invalid IPFS_API_URL %q: must be an absolute URL", v)
+		}
+		kuboAPIURL = strings.TrimSuffix(v, "/")
+	}
 
-		_, err = io.Copy(part, file)
+	if v := config.DBPath; v != "" {
+		db, err := openUploadDB(v)
 		if err != nil {
-			fmt.Println("Error copying file:", err)
-			file.Close()
-			continue
+			log.Fatalf("❌ Could not open DB_PATH %q: %v", v, err)
+		}
+		uploadDB = db
+	}
+
+	if v := config.StorageProvider; v != "" {
+		storageProvider = strings.ToLower(v)
+	}
+	p, err := newPinner(storageProvider)
+	if err != nil {
+		log.Fatalf("❌ Invalid STORAGE_PROVIDER: %v", err)
+	}
+	pinner = p
+
+	if config.AllowTenantCredentials == "true" {
+		if storageProvider != "pinata" {
+			log.Fatalf("❌ ALLOW_TENANT_CREDENTIALS needs STORAGE_PROVIDER=pinata")
+		}
+		allowTenantCredentials = true
+	}
+
+	if config.CompressBeforePin == "true" {
+		// Only pin metadata tells the proxy a CID holds gzipped bytes.
+		if _, ok := pinner.(pinFinder); !ok {
+			log.Fatalf("❌ COMPRESS_BEFORE_PIN needs STORAGE_PROVIDER=pinata; %s does not store pin metadata", storageProvider)
+		}
+		compressBeforePin = true
+	}
+}
+
+// newPinataClients builds a client per key/secret pair parsed from
+// PINATA_API_KEY and PINATA_SECRET_API_KEY, or a single one when there is
+// at most one pair. A JWT authenticates a single account and takes
+// precedence over keys.
+func newPinataClients(keys, secrets []string, jwt bool) []*pinata.Client {
+	if len(keys) <= 1 || jwt {
+		var key, secret string
+		if len(keys) > 0 {
+			key, secret = keys[0], secrets[0]
+		}
+		return []*pinata.Client{pinata.NewClient(key, secret, pinataOptions...)}
+	}
+	clients := make([]*pinata.Client, len(keys))
+	for i := range keys {
+		clients[i] = pinata.NewClient(keys[i], secrets[i], pinataOptions...)
+	}
+	return clients
+}
+
+// validateConfig checks the settings the server cannot run without, so a
+// missing key fails at startup instead of as a Pinata 401 on first upload.
+func validateConfig() {
+	if err := prepareUploadTmpDir(); err != nil {
+		log.Fatalf("❌ Invalid UPLOAD_TMP_DIR %q: %v", uploadTmpDir, err)
+	}
+
+	fmt.Printf("🗄️  Storage provider: %s\n", storageProvider)
+	if storageProvider != "pinata" {
+		return
+	}
+
+	if config.PinataJWT == "" {
+		for _, setting := range []struct{ name, value string }{
+			{"PINATA_API_KEY", config.PinataAPIKey},
+			{"PINATA_SECRET_API_KEY", config.PinataSecretAPIKey},
+		} {
+			if setting.value == "" {
+				log.Fatalf("❌ %s is not set; add it (or PINATA_JWT) to .env, the config file or the environment", setting.name)
+			}
+		}
+	}
+	if len(pinataClients) > 1 {
+		fmt.Printf("🔑 Authenticating to Pinata with %s, rotating across %d accounts\n", pinataClient.AuthMethod(), len(pinataClients))
+		return
+	}
+	fmt.Printf("🔑 Authenticating to Pinata with %s\n", pinataClient.AuthMethod())
+}
+
+func fileTooLargeError() fiber.Map {
+	return fiber.Map{"error": fmt.Sprintf("%v of %d bytes", errFileTooLarge, maxUploadBytes)}
+}
+
+// contentTypeErrorResponse maps a checkContentType failure to 415 for a
+// disallowed type, or 500 when the file couldn't be read.
+func contentTypeErrorResponse(c *fiber.Ctx, err error) error {
+	var mediaErr *unsupportedMediaTypeError
+	if errors.As(err, &mediaErr) {
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
+
+// pinErrorResponse reports a failed upload, picking the status from the
+// kind of error and falling back to status for anything unrecognised. It
+// adds Pinata's own status code and reason when the error came from its
+// API. Pinata rejecting the server's credentials is a 502 with its own
+// message, so clients don't mistake it for a problem with their request.
+func pinErrorResponse(c *fiber.Ctx, status int, err error) error {
+	body := fiber.Map{"error": err.Error()}
+	var apiErr *pinata.APIError
+	if errors.As(err, &apiErr) {
+		body["pinata_status"] = apiErr.StatusCode
+		if apiErr.Reason != "" {
+			body["reason"] = apiErr.Reason
+		}
+	}
+
+	var tenantErr *tenantAuthError
+	var infected *infectedFileError
+	switch {
+	case errors.As(err, &tenantErr):
+		// The caller's own credentials, not the server's.
+	case errors.Is(err, pinata.ErrUnauthorized):
+		warnPinataAuth(apiErr)
+		body["error"] = "the server's Pinata credentials were rejected: " + err.Error()
+	case errors.Is(err, pinata.ErrRateLimited):
+		body["error"] = "Pinata is rate limiting the server, retry later: " + err.Error()
+	case errors.As(err, &infected):
+		body["signature"] = infected.signature
+	}
+	return c.Status(pinErrorStatus(status, err)).JSON(body)
+}
+
+// pinErrorStatus is the status pinErrorResponse sends for err, or status
+// when the kind of error isn't recognised.
+func pinErrorStatus(status int, err error) int {
+	var groupErr *groupRejectedError
+	var tenantErr *tenantAuthError
+	var mediaErr *unsupportedMediaTypeError
+	var infected *infectedFileError
+	switch {
+	case errors.As(err, &groupErr):
+		return fiber.StatusBadRequest
+	case errors.As(err, &tenantErr):
+		return fiber.StatusUnauthorized
+	case errors.Is(err, pinata.ErrUnauthorized):
+		return fiber.StatusBadGateway
+	case errors.Is(err, pinata.ErrRateLimited):
+		return fiber.StatusServiceUnavailable
+	case errors.Is(err, errFileTooLarge):
+		return fiber.StatusRequestEntityTooLarge
+	case errors.Is(err, errInvalidCID), errors.Is(err, errEmptyFile):
+		return fiber.StatusBadRequest
+	case errors.As(err, &mediaErr):
+		return fiber.StatusUnsupportedMediaType
+	case errors.As(err, &infected):
+		return fiber.StatusUnprocessableEntity
+	case errors.Is(err, errPinUnconfirmed), errors.Is(err, context.DeadlineExceeded):
+		return fiber.StatusGatewayTimeout
+	}
+	return status
+}
+
+// isPublicGateway reports whether gateway is hosted on ipfs.io.
+func isPublicGateway(gateway string) bool {
+	u, err := url.Parse(gateway)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	return host == "ipfs.io" || strings.HasSuffix(host, ".ipfs.io")
+}
+
+func gatewayURL(cid string) string {
+	if pinataGatewayDomain == "" {
+		return ipfsGateway + cid
+	}
+	u := "https://" + pinataGatewayDomain + "/ipfs/" + cid
+	if pinataGatewayToken != "" {
+		u += "?pinataGatewayToken=" + url.QueryEscape(pinataGatewayToken)
+	}
+	return u
+}
+
+type uploadResult struct {
+	Filename        string            `json:"filename"`
+	CID             string            `json:"cid,omitempty"`
+	IpfsURL         string            `json:"ipfs_url,omitempty"`
+	Size            int64             `json:"size,omitempty"`
+	ContentType     string            `json:"content_type,omitempty"`
+	SHA256          string            `json:"sha256,omitempty"`
+	Hashes          map[string]string `json:"hashes,omitempty"`
+	Cached          bool              `json:"cached,omitempty"`
+	DryRun          bool              `json:"dry_run,omitempty"`
+	PinStatus       string            `json:"pin_status,omitempty"`
+	Private         bool              `json:"private,omitempty"`
+	ContentEncoding string            `json:"content_encoding,omitempty"`
+	Error           string            `json:"error,omitempty"`
+}
+
+// missingFileError explains a missing "file" part by listing the multipart
+// fields the client actually sent.
+func missingFileError(c *fiber.Ctx) string {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return "no file under field 'file'; request is not a valid multipart form"
+	}
+
+	var fields []string
+	for name := range form.File {
+		fields = append(fields, name)
+	}
+	for name := range form.Value {
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+
+	return fmt.Sprintf("no file under field 'file'; got fields: [%s]", strings.Join(fields, ", "))
+}
+
+// metadataFromForm reads the optional name and keyvalues form fields.
+func metadataFromForm(c *fiber.Ctx) (pinata.Metadata, error) {
+	metadata := pinata.Metadata{Name: c.FormValue("name")}
+	if kv := c.FormValue("keyvalues"); kv != "" {
+		if err := json.Unmarshal([]byte(kv), &metadata.KeyValues); err != nil {
+			return metadata, errors.New("keyvalues must be a JSON object")
 		}
-		file.Close()
-		writer.Close()
+	}
+	return metadata, nil
+}
+
+func uploadHandler(c *fiber.Ctx) error {
+	opts, err := uploadOptionsFromRequest(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	opts.metadata, err = metadataFromForm(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
 
-		req, err := http.NewRequest("POST", "http://localhost:3000/upload", body)
+	if form, err := c.MultipartForm(); err == nil && len(form.File["files"]) > 0 {
+		return multiUploadHandler(c, form.File["files"], opts)
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": missingFileError(c)})
+	}
+
+	if fileHeader.Size > maxUploadBytes {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fileTooLargeError())
+	}
+	if fileHeader.Size == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": errEmptyFile.Error()})
+	}
+
+	if c.Query("extract") == "true" {
+		return archiveUploadHandler(c, fileHeader, opts)
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "File open failed"})
+	}
+	defer file.Close()
+
+	contentType, err := checkContentType(file)
+	if err != nil {
+		return contentTypeErrorResponse(c, err)
+	}
+
+	if c.Query("dryRun") == "true" {
+		result, err := dryRunUpload(file, fileHeader)
 		if err != nil {
-			fmt.Println("Error creating request:", err)
-			continue
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(result)
+	}
+
+	if c.Query("progress") == "true" {
+		return startAsyncUpload(c, file, fileHeader, opts)
+	}
+	if c.Query("async") == "true" {
+		return enqueueUpload(c, file, fileHeader, opts)
+	}
+
+	file, cleanup, err := spillLargeUpload(file, fileHeader)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer cleanup()
+
+	start := time.Now()
+	result, err := uploadToIPFS(c.UserContext(), file, fileHeader, opts)
+	if err != nil {
+		return pinErrorResponse(c, fiber.StatusInternalServerError, err)
+	}
+	// Let shell scripts read the outcome without parsing the body.
+	c.Set("X-IPFS-CID", result.CID)
+	c.Set("X-Upload-Duration-Ms", strconv.FormatInt(time.Since(start).Milliseconds(), 10))
+
+	// ?redirect=true lets a plain HTML form land the browser on the pinned
+	// content. Failures still answer with JSON.
+	redirect := c.Query("redirect") == "true"
+
+	if generateThumbnails && strings.HasPrefix(contentType, "image/") {
+		if thumb, ok := pinThumbnail(c.UserContext(), file, fileHeader, opts); ok && !redirect {
+			return c.JSON(thumbnailResult{uploadResult: result, Thumbnail: thumb})
+		}
+	}
+
+	if redirect {
+		return c.Redirect(result.IpfsURL, fiber.StatusFound)
+	}
+	return c.JSON(result)
+}
+
+// multiUploadResult is one file's entry in a multi-file response. cid and
+// error are always present, with exactly one of them null.
+type multiUploadResult struct {
+	uploadResult
+	CID   *string `json:"cid"`
+	Error *string `json:"error"`
+}
+
+// multiUploadHandler pins every file sent under the "files" field. A failing
+// file is reported in its own result instead of aborting the batch. The
+// status is 200 when every file was pinned, 207 Multi-Status when only some
+// were and 502 when none were. When every file failed over a problem with
+// the request itself, such as an empty or oversized file, the status is
+// that 4xx instead (400 if they differ). The batch instead stops with 413 once
+// MAX_TOTAL_UPLOAD_BYTES is used up, listing the files handled so far. Each
+// pin is named after its own file unless a name was given explicitly.
+func multiUploadHandler(c *fiber.Ctx, fileHeaders []*multipart.FileHeader, opts uploadOptions) error {
+	if len(fileHeaders) > maxFilesPerRequest {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("too many files: got %d, at most %d are allowed per request", len(fileHeaders), maxFilesPerRequest),
+		})
+	}
+
+	results := make([]multiUploadResult, 0, len(fileHeaders))
+	failed := 0
+	var total int64
+	// clientStatus is the 4xx shared by every failure so far, 400 when they
+	// differ, or 0 once any failure wasn't the client's.
+	clientStatus := -1
+
+	for _, fileHeader := range fileHeaders {
+		total += fileHeader.Size
+		if maxTotalUploadBytes > 0 && total > maxTotalUploadBytes {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+				"error":   fmt.Sprintf("files exceed the max total size of %d bytes at %s", maxTotalUploadBytes, fileHeader.Filename),
+				"pinned":  len(results) - failed,
+				"results": results,
+			})
 		}
-		req.Header.Set("Content-Type", writer.FormDataContentType())
 
-		client := &http.Client{}
-		resp, err := client.Do(req)
+		result, err := pinFileHeader(c.UserContext(), fileHeader, opts)
 		if err != nil {
-			fmt.Println("Upload failed:", err)
+			msg := err.Error()
+			results = append(results, multiUploadResult{uploadResult: uploadResult{Filename: fileHeader.Filename}, Error: &msg})
+			failed++
+			switch s := pinErrorStatus(fiber.StatusBadGateway, err); {
+			case s >= 500:
+				clientStatus = 0
+			case clientStatus == -1:
+				clientStatus = s
+			case clientStatus != 0 && clientStatus != s:
+				clientStatus = fiber.StatusBadRequest
+			}
 			continue
 		}
+		cid := result.CID
+		results = append(results, multiUploadResult{uploadResult: result, CID: &cid})
+	}
+
+	status := fiber.StatusOK
+	switch {
+	case failed == len(fileHeaders) && clientStatus > 0:
+		status = clientStatus
+	case failed == len(fileHeaders):
+		status = fiber.StatusBadGateway
+	case failed > 0:
+		status = fiber.StatusMultiStatus
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"results":   results,
+		"succeeded": len(fileHeaders) - failed,
+		"failed":    failed,
+	})
+}
+
+func pinFileHeader(ctx context.Context, fileHeader *multipart.FileHeader, opts uploadOptions) (uploadResult, error) {
+	if fileHeader.Size > maxUploadBytes {
+		return uploadResult{}, fmt.Errorf("%w of %d bytes", errFileTooLarge, maxUploadBytes)
+	}
+	if fileHeader.Size == 0 {
+		return uploadResult{}, errEmptyFile
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return uploadResult{}, errors.New("File open failed")
+	}
+	defer file.Close()
+
+	if _, err := checkContentType(file); err != nil {
+		return uploadResult{}, err
+	}
+
+	file, cleanup, err := spillLargeUpload(file, fileHeader)
+	if err != nil {
+		return uploadResult{}, err
+	}
+	defer cleanup()
+
+	return uploadToIPFS(ctx, file, fileHeader, opts)
+}
 
-		respBody, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
+// dirUploadEntry lists one file of a directory upload in the response.
+type dirUploadEntry struct {
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	IpfsURL string `json:"ipfs_url"`
+}
+
+// uploadDirHandler pins the files sent under "files" as one directory, so a
+// website or NFT collection gets a single root CID. Each part's filename is
+// its path inside the directory, e.g. "images/1.png"; the directory itself
+// is named by the dir_name field.
+func uploadDirHandler(c *fiber.Ctx) error {
+	opts, err := uploadOptionsFromRequest(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	opts.metadata, err = metadataFromForm(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["files"]) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "no files under field 'files'"})
+	}
+	fileHeaders := form.File["files"]
+	if len(fileHeaders) > maxFilesPerRequest {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("too many files: got %d, at most %d are allowed per request", len(fileHeaders), maxFilesPerRequest),
+		})
+	}
+
+	dirName, err := dirNameFromForm(c, "upload")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	files := make([]dirUploadFile, len(fileHeaders))
+	seen := make(map[string]bool, len(fileHeaders))
+	var total int64
+	for i, fh := range fileHeaders {
+		// The directory is pinned in one request, so nothing has been
+		// pinned yet when the total runs over.
+		total += fh.Size
+		if maxTotalUploadBytes > 0 && total > maxTotalUploadBytes {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+				"error":  fmt.Sprintf("files exceed the max total size of %d bytes", maxTotalUploadBytes),
+				"pinned": 0,
+			})
+		}
+
+		rel, err := relativeUploadPath(fh)
 		if err != nil {
-			fmt.Println("Error reading response:", err)
-			continue
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		if seen[rel] {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("duplicate path %q", rel)})
+		}
+		seen[rel] = true
+		files[i] = dirUploadFile{path: rel, size: fh.Size, open: fh.Open}
+	}
+
+	return pinDirResponse(c, dirName, files, opts)
+}
+
+// pinDirResponse pins files as directory dirName and answers with its CID
+// and the URL of every file inside it.
+func pinDirResponse(c *fiber.Ctx, dirName string, files []dirUploadFile, opts uploadOptions) error {
+	cid, err := uploadDirToIPFS(c.UserContext(), dirName, files, opts)
+	if err != nil {
+		return pinErrorResponse(c, fiber.StatusInternalServerError, err)
+	}
+
+	entries := make([]dirUploadEntry, len(files))
+	for i, f := range files {
+		entries[i] = dirUploadEntry{Path: f.path, Size: f.size, IpfsURL: gatewayURL(cid + "/" + escapeURLPath(f.path))}
+	}
+	return c.JSON(fiber.Map{
+		"cid":      cid,
+		"ipfs_url": gatewayURL(cid),
+		"files":    entries,
+	})
+}
+
+// dirNameFromForm reads the dir_name field naming a directory upload,
+// defaulting to fallback.
+func dirNameFromForm(c *fiber.Ctx, fallback string) (string, error) {
+	dirName := c.FormValue("dir_name", fallback)
+	if dirName == "." || dirName == ".." || strings.ContainsAny(dirName, `/\`) {
+		return "", errors.New("dir_name must be a single path segment")
+	}
+	return dirName, nil
+}
+
+// relativeUploadPath returns the path a directory upload part was sent
+// with. mime/multipart reduces FileHeader.Filename to its last element, so
+// the path is read back from the part's Content-Disposition header.
+func relativeUploadPath(fh *multipart.FileHeader) (string, error) {
+	name := fh.Filename
+	if _, params, err := mime.ParseMediaType(fh.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		name = params["filename"]
+	}
+
+	return cleanRelativePath(name)
+}
+
+// cleanRelativePath normalises a slash- or backslash-separated path inside
+// an uploaded directory, rejecting absolute paths and any that climb out of
+// it with "..".
+func cleanRelativePath(name string) (string, error) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	clean := path.Clean(name)
+	if name == "" || path.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("invalid file path %q: must be relative and stay inside the directory", name)
+	}
+	return clean, nil
+}
+
+// escapeURLPath escapes each segment of a slash-separated path for a URL.
+func escapeURLPath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+func uploadJSONHandler(c *fiber.Ctx) error {
+	// The body is the content to pin, so any JSON is accepted as is.
+	body := c.Body()
+	if int64(len(body)) > maxUploadBytes {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fileTooLargeError())
+	}
+	if len(body) == 0 || !json.Valid(body) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Body must be valid JSON"})
+	}
+
+	jsonPin, ok := pinner.(jsonPinner)
+	if !ok {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": fmt.Sprintf("%s cannot pin JSON", storageProvider)})
+	}
+	cid, err := jsonPin.PinJSON(uploadContext(c), json.RawMessage(body), pinata.Metadata{})
+	if err != nil {
+		return pinErrorResponse(c, fiber.StatusInternalServerError, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"cid":      cid,
+		"ipfs_url": gatewayURL(cid),
+	})
+}
+
+func uploadURLHandler(c *fiber.Ctx) error {
+	var req struct {
+		URL string `json:"url"`
+	}
+	if err := decodeJSONBody(c, &req, maxJSONRequestBytes); err != nil {
+		return jsonBodyErrorResponse(c, err)
+	}
+	if req.URL == "" {
+		return jsonBodyErrorResponse(c, &requestFieldError{field: "url", msg: `is required, e.g. {"url":"https://..."}`})
+	}
+
+	opts, err := uploadOptionsFromRequest(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	file, filename, size, err := downloadToTempFile(c.Context(), req.URL)
+	if errors.Is(err, errDownloadTooLarge) {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fileTooLargeError())
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	contentType, err := checkContentType(file)
+	if err != nil {
+		return contentTypeErrorResponse(c, err)
+	}
+
+	fileHeader := newFileHeader(filename, size, contentType)
+	result, err := uploadToIPFS(uploadContext(c), file, fileHeader, opts)
+	if err != nil {
+		return pinErrorResponse(c, fiber.StatusInternalServerError, err)
+	}
+
+	return c.JSON(result)
+}
+
+func unpinHandler(c *fiber.Ctx) error {
+	cid := c.Params("cid")
+	if !isValidCID(cid) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid CID"})
+	}
+
+	unpin, ok := pinner.(unpinner)
+	if !ok {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": fmt.Sprintf("%s cannot unpin", storageProvider)})
+	}
+	if err := unpin.Unpin(c.Context(), cid); err != nil {
+		return pinErrorResponse(c, fiber.StatusBadGateway, err)
+	}
+	forgetUnpinned(cid)
+
+	return c.JSON(fiber.Map{"cid": cid, "status": "unpinned"})
+}
+
+const (
+	maxUnpinBatch         = 100
+	unpinBatchConcurrency = 5
+)
+
+// unpinBatchResult is one CID's outcome in an /unpin-batch response.
+type unpinBatchResult struct {
+	CID    string `json:"cid"`
+	Status string `json:"status"` // unpinned, not_pinned or failed
+	Error  string `json:"error,omitempty"`
+}
+
+// unpinBatchHandler unpins up to maxUnpinBatch CIDs, a few at a time. A CID
+// the backend no longer pins counts as done, so a cleanup script can be
+// rerun. The status is 200 when nothing failed, 207 Multi-Status when some
+// CIDs did and 502 when all of them did.
+func unpinBatchHandler(c *fiber.Ctx) error {
+	var req struct {
+		CIDs []string `json:"cids"`
+	}
+	if err := decodeJSONBody(c, &req, maxJSONRequestBytes); err != nil {
+		return jsonBodyErrorResponse(c, err)
+	}
+	if len(req.CIDs) == 0 {
+		return jsonBodyErrorResponse(c, &requestFieldError{field: "cids", msg: `is required, e.g. {"cids":["...","..."]}`})
+	}
+	if len(req.CIDs) > maxUnpinBatch {
+		return jsonBodyErrorResponse(c, &requestFieldError{field: "cids", msg: fmt.Sprintf("lists %d CIDs, at most %d are allowed per request", len(req.CIDs), maxUnpinBatch)})
+	}
+
+	var cids []string
+	seen := map[string]bool{}
+	for _, cid := range req.CIDs {
+		if !isValidCID(cid) {
+			return jsonBodyErrorResponse(c, &requestFieldError{field: "cids", msg: fmt.Sprintf("contains %q, which is not a valid CID", cid)})
+		}
+		if !seen[cid] {
+			seen[cid] = true
+			cids = append(cids, cid)
+		}
+	}
+
+	unpin, ok := pinner.(unpinner)
+	if !ok {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": fmt.Sprintf("%s cannot unpin", storageProvider)})
+	}
+
+	// UserContext sets the context on first use, so it is fetched once
+	// here rather than racing from every goroutine.
+	ctx := c.UserContext()
+	results := make([]unpinBatchResult, len(cids))
+	sem := make(chan struct{}, unpinBatchConcurrency)
+	var wg sync.WaitGroup
+	for i, cid := range cids {
+		i, cid := i, cid
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			results[i] = unpinBatchResult{CID: cid, Status: "unpinned"}
+			err := unpin.Unpin(ctx, cid)
+			switch {
+			case isNotPinned(err):
+				results[i].Status = "not_pinned"
+			case err != nil:
+				results[i].Status = "failed"
+				results[i].Error = err.Error()
+				return
+			}
+			forgetUnpinned(cid)
+		}()
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, r := range results {
+		if r.Status == "failed" {
+			failed++
+		}
+	}
+	status := fiber.StatusOK
+	switch {
+	case failed == len(results):
+		status = fiber.StatusBadGateway
+	case failed > 0:
+		status = fiber.StatusMultiStatus
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"results":   results,
+		"succeeded": len(results) - failed,
+		"failed":    failed,
+	})
+}
+
+// pinMetadataHandler returns the name, keyvalues, size and pin date stored
+// with cid, as attached at upload time.
+func pinMetadataHandler(c *fiber.Ctx) error {
+	cid := c.Params("cid")
+	if !isValidCID(cid) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid CID"})
+	}
+	finder, ok := pinner.(pinFinder)
+	if !ok {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": fmt.Sprintf("%s does not store pin metadata", storageProvider)})
+	}
+
+	pin, err := finder.FindPin(c.Context(), cid)
+	if err != nil {
+		return pinErrorResponse(c, fiber.StatusBadGateway, err)
+	}
+	if pin == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "CID is not pinned in this account"})
+	}
+
+	keyValues := pin.Metadata.KeyValues
+	if keyValues == nil {
+		keyValues = map[string]interface{}{}
+	}
+	return c.JSON(fiber.Map{
+		"cid":         cid,
+		"name":        pin.Metadata.Name,
+		"keyvalues":   keyValues,
+		"size":        pin.Size,
+		"date_pinned": pin.DatePinned,
+	})
+}
+
+// pinByHashHandler asks Pinata to pin a CID that is already on the network.
+// It answers 200 when Pinata already has the content and 202 while Pinata
+// is still searching for it.
+func pinByHashHandler(c *fiber.Ctx) error {
+	var req struct {
+		CID  string `json:"cid"`
+		Name string `json:"name"`
+	}
+	if err := decodeJSONBody(c, &req, maxJSONRequestBytes); err != nil {
+		return jsonBodyErrorResponse(c, err)
+	}
+	if req.CID == "" {
+		return jsonBodyErrorResponse(c, &requestFieldError{field: "cid", msg: `is required, e.g. {"cid":"...","name":"..."}`})
+	}
+	if !isValidCID(req.CID) {
+		return jsonBodyErrorResponse(c, &requestFieldError{field: "cid", msg: "is not a valid CID"})
+	}
+	byHash, ok := pinner.(hashPinner)
+	if !ok {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": fmt.Sprintf("%s cannot pin by hash", storageProvider)})
+	}
+
+	pin, err := byHash.PinByHash(c.Context(), req.CID, pinata.Metadata{Name: req.Name})
+	if err != nil {
+		return pinErrorResponse(c, fiber.StatusBadGateway, err)
+	}
+
+	status := fiber.StatusAccepted
+	if pin.Status == "pinned" {
+		status = fiber.StatusOK
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"cid":      req.CID,
+		"id":       pin.ID,
+		"status":   pin.Status,
+		"ipfs_url": gatewayURL(req.CID),
+	})
+}
+
+const (
+	defaultPinListLimit = 10
+	maxPinListLimit     = 1000
+)
+
+// listPinsHandler proxies Pinata's pinList across every account. Pages are
+// 1-based and translated into Pinata's pageOffset/pageLimit.
+func listPinsHandler(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	limit := c.QueryInt("limit", defaultPinListLimit)
+	if page < 1 || limit < 1 || limit > maxPinListLimit {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("page must be >= 1 and limit between 1 and %d", maxPinListLimit),
+		})
+	}
+
+	status := c.Query("status", "pinned")
+	if status != "pinned" && status != "unpinned" && status != "all" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "status must be one of pinned, unpinned, all"})
+	}
+
+	lister, ok := pinner.(pinLister)
+	if !ok {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": fmt.Sprintf("%s cannot list pins", storageProvider)})
+	}
+
+	pinList, err := lister.ListPins(c.Context(), (page-1)*limit, limit, status)
+	if err != nil {
+		return pinErrorResponse(c, fiber.StatusBadGateway, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"total": pinList.Count,
+		"page":  page,
+		"limit": limit,
+		"pins":  pinList.Rows,
+	})
+}
+
+const defaultUploadsLimit = 100
+
+// listUploadsHandler queries the local upload index. from/to accept
+// RFC 3339 timestamps or plain YYYY-MM-DD dates.
+func listUploadsHandler(c *fiber.Ctx) error {
+	if uploadDB == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "upload history is disabled; set DB_PATH to enable it"})
+	}
+
+	filter := uploadFilter{
+		filename: c.Query("filename"),
+		limit:    c.QueryInt("limit", defaultUploadsLimit),
+	}
+	if filter.limit < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit must be >= 1"})
+	}
+
+	var err error
+	if filter.from, err = parseDateParam(c.Query("from"), false); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid from: " + err.Error()})
+	}
+	if filter.to, err = parseDateParam(c.Query("to"), true); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid to: " + err.Error()})
+	}
+
+	records, err := queryUploads(c.Context(), filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"uploads": records})
+}
+
+// statsHandler summarizes the local upload index, reporting zeros when it
+// is empty or DB_PATH is unset.
+func statsHandler(c *fiber.Ctx) error {
+	stats, err := queryUploadStats(c.Context(), time.Now().Add(-24*time.Hour))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(stats)
+}
+
+// parseDateParam parses an RFC 3339 timestamp or a YYYY-MM-DD date. A bare
+// date used as the end of a range covers that whole day.
+func parseDateParam(v string, endOfDay bool) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return time.Time{}, errors.New("expected RFC 3339 or YYYY-MM-DD")
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Second)
+	}
+	return t, nil
+}
+
+const healthCheckTimeout = 5 * time.Second
+
+// healthHandler reports liveness. With ?deep=true it also checks the
+// storage backend: the Pinata API keys against /data/testAuthentication, or
+// that the Kubo daemon answers. The backend's status is reported under its
+// STORAGE_PROVIDER name.
+func healthHandler(c *fiber.Ctx) error {
+	if c.Query("deep") != "true" {
+		return c.JSON(fiber.Map{"status": "ok"})
+	}
+	checker, ok := pinner.(healthChecker)
+	if !ok {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": fmt.Sprintf("%s has no deep health check", storageProvider)})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	if err := checker.CheckHealth(ctx); err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"status": "unavailable", "error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"status": "ok", storageProvider: "ok"})
+}
+
+const shutdownTimeout = 10 * time.Second
+
+// inFlightRequests counts requests currently being handled so shutdown can
+// report how much work it is draining.
+var inFlightRequests int64
+
+func trackInFlight(c *fiber.Ctx) error {
+	atomic.AddInt64(&inFlightRequests, 1)
+	defer atomic.AddInt64(&inFlightRequests, -1)
+	return c.Next()
+}
+
+func startFiberApp(wg *sync.WaitGroup) {
+	defer wg.Done()
+	fmt.Println("🏷️  Version", versionString())
+	validateConfig()
+	sweepStaleSpills()
+
+	app := fiber.New(fiber.Config{
+		// Leave headroom for the multipart envelope and base64's 4/3
+		// expansion so the explicit size checks in the handlers can report
+		// the limit precisely.
+		BodyLimit: int(maxUploadBytes/3*4) + 1<<20,
+		// Only believe forwarded client IPs from configured proxies.
+		EnableTrustedProxyCheck: len(trustedProxies) > 0,
+		TrustedProxies:          trustedProxies,
+		ProxyHeader:             proxyHeaderIfTrusted(),
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			if errors.Is(err, fiber.ErrRequestEntityTooLarge) {
+				return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fileTooLargeError())
+			}
+			// Answer Fiber's own errors, such as unknown routes, in the same
+			// {"error": ...} envelope as the handlers.
+			code := fiber.StatusInternalServerError
+			var fiberErr *fiber.Error
+			if errors.As(err, &fiberErr) {
+				code = fiberErr.Code
+			}
+			return c.Status(code).JSON(fiber.Map{"error": err.Error()})
+		},
+	})
+
+	app.Use(requestIDMiddleware())
+	app.Use(captureRequests)
+	app.Use(requestLogger())
+	app.Use(trackInFlight)
+	app.Use(responseCompression())
+	app.Use(cors.New(cors.Config{
+		AllowOrigins: allowedOrigins,
+		// Browser clients need to read the tus protocol headers and the
+		// upload result headers.
+		ExposeHeaders: "Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Offset, Upload-Length, Upload-CID, Idempotent-Replayed, X-IPFS-CID, X-Upload-Duration-Ms",
+	}))
+
+	startWorkers()
+	rateLimited := uploadRateLimiter()
+
+	app.Get("/health", healthHandler)
+	app.Get("/version", versionHandler)
+	app.Post("/upload", rateLimited, requireAPIToken, enforceRequestTimeout, idempotentUpload, limitConcurrentUploads, uploadHandler)
+	app.Get("/upload/:id/progress", requireAPIToken, uploadProgressHandler)
+	app.Get("/jobs/:id", requireAPIToken, jobHandler)
+	app.Delete("/jobs/:id", requireAPIToken, cancelJobHandler)
+	app.Post("/upload-dir", rateLimited, requireAPIToken, enforceRequestTimeout, limitConcurrentUploads, uploadDirHandler)
+	app.Post("/upload-json", rateLimited, requireAPIToken, limitConcurrentUploads, uploadJSONHandler)
+	app.Post("/upload-url", rateLimited, requireAPIToken, limitConcurrentUploads, uploadURLHandler)
+	app.Post("/upload-base64", rateLimited, requireAPIToken, limitConcurrentUploads, uploadBase64Handler)
+
+	app.Get("/ws/upload", requireWebSocket, rateLimited, requireAPIToken, websocket.New(wsUploadHandler))
+
+	files := app.Group("/files", tusHeaders)
+	files.Options("", tusOptionsHandler)
+	files.Post("", rateLimited, requireAPIToken, tusCreateHandler)
+	files.Head("/:id", requireAPIToken, tusHeadHandler)
+	files.Patch("/:id", requireAPIToken, tusPatchHandler)
+
+	app.Post("/pin-by-hash", rateLimited, requireAPIToken, pinByHashHandler)
+	app.Post("/publish", rateLimited, requireAPIToken, publishHandler)
+	app.Delete("/pin/:cid", rateLimited, requireAPIToken, unpinHandler)
+	app.Post("/unpin-batch", rateLimited, requireAPIToken, unpinBatchHandler)
+	app.Get("/pin/:cid/metadata", rateLimited, requireAPIToken, pinMetadataHandler)
+	app.Get("/is-pinned/:cid", rateLimited, requireAPIToken, isPinnedHandler)
+	app.Get("/pins", rateLimited, requireAPIToken, listPinsHandler)
+	app.Get("/cid/:cid", cidProxyHandler)
+	app.Get("/uploads", rateLimited, requireAPIToken, listUploadsHandler)
+	app.Get("/stats", rateLimited, requireAPIToken, statsHandler)
+	if enableMetrics {
+		app.Get("/metrics", metricsHandler())
+	}
+
+	listenErr := make(chan error, 1)
+	go func() {
+		scheme := "http"
+		if tlsEnabled() {
+			scheme = "https"
 		}
+		fmt.Printf("🚀 Server started at %s://localhost:%s\n", scheme, port)
+		listenErr <- listen(app, ":"+port)
+	}()
 
-		fmt.Println("Response from server:", string(respBody))
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err := <-listenErr:
+		log.Fatal(err)
+	case sig := <-quit:
+		fmt.Printf("🛑 Received %s, shutting down with %d request(s) in flight\n", sig, atomic.LoadInt64(&inFlightRequests))
+	}
+
+	// Background jobs upload outside any request, so they are drained
+	// alongside the requests Shutdown waits for.
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- app.ShutdownWithTimeout(shutdownTimeout) }()
+	drainUploads(shutdownTimeout)
+	if err := <-shutdownErr; err != nil {
+		log.Println("❌ Shutdown error:", err)
 	}
+	removeAllSpills()
+	fmt.Println("👋 Server stopped")
 }
 
 func main() {
-	loadEnv()
+	configPath, args := splitConfigFlag(os.Args[1:])
+
+	// Answer --version before loadEnv, without reading any configuration.
+	if len(args) > 0 && (args[0] == "--version" || args[0] == "version") {
+		fmt.Println("ipfs-fiber-uploader", versionString())
+		return
+	}
+
+	loadEnv(configPath)
 
-	if len(os.Args) > 1 {
-		switch os.Args[1] {
+	if len(args) > 0 {
+		switch args[0] {
 		case "server":
 			// Run only the Fiber web server
 			var wg sync.WaitGroup
 			wg.Add(1)
 			go startFiberApp(&wg)
-			wg.Wait() // will block forever
+			wg.Wait() // blocks until SIGINT/SIGTERM
 		case "cli":
-			// Run only CLI uploader, assumes server is running on localhost:3000
-			cliUpload()
+			// Run only CLI uploader against SERVER_URL (default localhost:PORT)
+			cliUpload(parseCLIFlags(args[1:]))
+		case "decrypt":
+			// Fetch an encrypted upload by CID and decrypt it with ENCRYPTION_KEY
+			cliDecrypt(args[1:])
+		case "selftest":
+			// Pin, fetch back and compare a small file to check the setup
+			runSelfTest(args[1:])
 		default:
-			fmt.Println("Unknown argument. Use 'server' or 'cli'")
+			fmt.Println("Unknown argument. Use 'server', 'cli', 'decrypt' or 'selftest'")
 		}
 		return
 	}
@@ -199,7 +1528,9 @@ func main() {
 	// Wait for server to start
 	time.Sleep(1 * time.Second)
 
-	cliUpload()
+	// The CLI runs alongside the server; the process exits once the server
+	// has shut down, even if the prompt is still waiting for input.
+	go cliUpload(cliOptions{})
 
 	wg.Wait()
 }
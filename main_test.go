@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const testCID = "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"
+
+// fakePinner pins by calling pin with the uploaded bytes.
+type fakePinner struct {
+	pin func(name string, content []byte) (string, error)
+}
+
+func (f *fakePinner) Pin(ctx context.Context, file io.ReadSeeker, name string) (string, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return "", err
+	}
+	return f.pin(name, content)
+}
+
+// useFakePinner makes pin the backend for the rest of the test, with an
+// empty dedup cache so earlier tests' uploads aren't reused.
+func useFakePinner(t *testing.T, pin func(name string, content []byte) (string, error)) {
+	t.Helper()
+	oldPinner, oldDedup := pinner, uploadDedup
+	pinner, uploadDedup = &fakePinner{pin: pin}, newDedupCache(defaultDedupCacheSize)
+	t.Cleanup(func() { pinner, uploadDedup = oldPinner, oldDedup })
+}
+
+type testFile struct {
+	name    string
+	content string
+}
+
+// multipartUpload builds a POST to path with files under field.
+func multipartUpload(t *testing.T, path, field string, files ...testFile) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, f := range files {
+		part, err := w.CreateFormFile(field, f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(part, f.content)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("POST", path, &body)
+	req.Header.Set(fiber.HeaderContentType, w.FormDataContentType())
+	return req
+}
+
+// doUpload sends req to uploadHandler and decodes the JSON response.
+func doUpload(t *testing.T, req *http.Request) (int, map[string]interface{}) {
+	t.Helper()
+	app := fiber.New()
+	app.Post("/upload", uploadHandler)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	return resp.StatusCode, body
+}
+
+func TestMultiUploadStatus(t *testing.T) {
+	errUpstream := errors.New("upstream failed")
+	pinOrFail := func(name string, content []byte) (string, error) {
+		if name == "fail.txt" {
+			return "", errUpstream
+		}
+		return testCID, nil
+	}
+
+	tests := []struct {
+		name   string
+		files  []testFile
+		status int
+		failed float64
+	}{
+		{"all pinned", []testFile{{"a.txt", "a"}, {"b.txt", "b"}}, fiber.StatusOK, 0},
+		{"some failed", []testFile{{"a.txt", "a"}, {"fail.txt", "b"}}, fiber.StatusMultiStatus, 1},
+		{"all failed upstream", []testFile{{"fail.txt", "a"}, {"fail.txt", "b"}}, fiber.StatusBadGateway, 2},
+		{"all empty", []testFile{{"a.txt", ""}, {"b.txt", ""}}, fiber.StatusBadRequest, 2},
+		{"client and upstream failures", []testFile{{"a.txt", ""}, {"fail.txt", "b"}}, fiber.StatusBadGateway, 2},
+		{"empty and pinned", []testFile{{"a.txt", ""}, {"b.txt", "b"}}, fiber.StatusMultiStatus, 1},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			useFakePinner(t, pinOrFail)
+			status, body := doUpload(t, multipartUpload(t, "/upload", "files", tt.files...))
+			if status != tt.status {
+				t.Errorf("status = %d, want %d (%v)", status, tt.status, body)
+			}
+			if body["failed"] != tt.failed {
+				t.Errorf("failed = %v, want %v", body["failed"], tt.failed)
+			}
+		})
+	}
+}
+
+func TestMultiUploadAllTooLarge(t *testing.T) {
+	useFakePinner(t, func(string, []byte) (string, error) {
+		t.Error("an oversized file reached the pinner")
+		return "", nil
+	})
+	old := maxUploadBytes
+	maxUploadBytes = 4
+	t.Cleanup(func() { maxUploadBytes = old })
+
+	status, body := doUpload(t, multipartUpload(t, "/upload", "files", testFile{"a.txt", "too large"}, testFile{"b.txt", "also too large"}))
+	if status != fiber.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want 413 (%v)", status, body)
+	}
+}
+
+func TestMultiUploadMixedClientErrors(t *testing.T) {
+	useFakePinner(t, func(string, []byte) (string, error) { return "", nil })
+	old := maxUploadBytes
+	maxUploadBytes = 4
+	t.Cleanup(func() { maxUploadBytes = old })
+
+	status, body := doUpload(t, multipartUpload(t, "/upload", "files", testFile{"a.txt", ""}, testFile{"b.txt", "too large"}))
+	if status != fiber.StatusBadRequest {
+		t.Errorf("status = %d, want 400 (%v)", status, body)
+	}
+}
+
+func TestUploadEmptyFile(t *testing.T) {
+	useFakePinner(t, func(name string, content []byte) (string, error) {
+		t.Errorf("pinned empty file %q", name)
+		return "", nil
+	})
+
+	for _, field := range []string{"file", "files"} {
+		status, body := doUpload(t, multipartUpload(t, "/upload", field, testFile{"empty.txt", ""}))
+		if status != fiber.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", field, status, fiber.StatusBadRequest)
+		}
+		if field == "file" && body["error"] != errEmptyFile.Error() {
+			t.Errorf("%s: error = %v, want %q", field, body["error"], errEmptyFile.Error())
+		}
+	}
+}
+
+func TestUploadWithThumbnailKeepsTopLevelFields(t *testing.T) {
+	const thumbCID = "QmfDmsHTywy6L9Ne5RXsj5YumDedfBLMvCvmaxjBoe6w4d"
+	useFakePinner(t, func(name string, content []byte) (string, error) {
+		if strings.HasPrefix(name, "thumb_") {
+			return thumbCID, nil
+		}
+		return testCID, nil
+	})
+	generateThumbnails = true
+	t.Cleanup(func() { generateThumbnails = false })
+
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 512, 512))); err != nil {
+		t.Fatal(err)
+	}
+	status, body := doUpload(t, multipartUpload(t, "/upload", "file", testFile{"photo.png", img.String()}))
+	if status != fiber.StatusOK {
+		t.Fatalf("status = %d, body %v", status, body)
+	}
+	if body["cid"] != testCID {
+		t.Errorf("cid = %v, want the original's %s", body["cid"], testCID)
+	}
+	if thumb, _ := body["thumbnail"].(map[string]interface{}); thumb["cid"] != thumbCID {
+		t.Errorf("thumbnail = %v, want cid %s", body["thumbnail"], thumbCID)
+	}
+
+	// The CLI decodes the same response without knowing about thumbnails.
+	raw, _ := json.Marshal(body)
+	result, err := decodeServerResult(&http.Response{StatusCode: 200, Body: io.NopCloser(bytes.NewReader(raw))})
+	if err != nil || result.CID != testCID {
+		t.Errorf("decodeServerResult = %+v, %v; want cid %s", result, err, testCID)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// enableMetrics exposes GET /metrics; set via ENABLE_METRICS=true.
+var enableMetrics bool
+
+var (
+	uploadsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ipfs_uploader_uploads_total",
+		Help: "Uploads pinned successfully.",
+	})
+	uploadFailuresTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ipfs_uploader_upload_failures_total",
+		Help: "Uploads that failed to pin.",
+	})
+	uploadBytesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ipfs_uploader_uploaded_bytes_total",
+		Help: "Bytes of file content pinned successfully.",
+	})
+	pinDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ipfs_uploader_pin_duration_seconds",
+		Help:    "Round-trip time of pin requests to the storage backend, retries included.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 10),
+	}, []string{"provider"})
+	uploadQueueDepth = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "ipfs_uploader_upload_queue_depth",
+		Help: "Upload requests waiting for a concurrency slot.",
+	}, func() float64 { return float64(atomic.LoadInt64(&queuedUploads)) })
+	uploadsInFlight = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "ipfs_uploader_uploads_in_flight",
+		Help: "Upload requests holding a concurrency slot.",
+	}, func() float64 { return float64(len(uploadSlots)) })
+)
+
+func init() {
+	prometheus.MustRegister(uploadsTotal, uploadFailuresTotal, uploadBytesTotal, pinDuration, uploadQueueDepth, uploadsInFlight)
+}
+
+func metricsHandler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.Handler())
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// allowedMIMETypes comes from ALLOWED_MIME_TYPES; empty allows everything.
+// Entries may be exact ("image/png") or wildcards ("image/*").
+var allowedMIMETypes []string
+
+type unsupportedMediaTypeError struct {
+	contentType string
+}
+
+func (e *unsupportedMediaTypeError) Error() string {
+	return fmt.Sprintf("content type %s is not allowed", e.contentType)
+}
+
+// sniffContentType detects the type from the first 512 bytes and rewinds
+// the file so those bytes are still uploaded.
+func sniffContentType(file io.ReadSeeker) (string, error) {
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(buf[:n]))
+	if err != nil {
+		return "application/octet-stream", nil
+	}
+	return mediaType, nil
+}
+
+// checkContentType sniffs file and rejects it unless its type is allowed.
+func checkContentType(file io.ReadSeeker) (string, error) {
+	contentType, err := sniffContentType(file)
+	if err != nil {
+		return "", err
+	}
+	if !mimeTypeAllowed(contentType) {
+		return contentType, &unsupportedMediaTypeError{contentType: contentType}
+	}
+	return contentType, nil
+}
+
+func mimeTypeAllowed(contentType string) bool {
+	if len(allowedMIMETypes) == 0 {
+		return true
+	}
+	for _, allowed := range allowedMIMETypes {
+		if mimeTypeMatches(allowed, contentType) {
+			return true
+		}
+	}
+	return false
+}
+
+// mimeTypeMatches reports whether contentType is pattern, or falls under
+// it when pattern is a wildcard like "image/*".
+func mimeTypeMatches(pattern, contentType string) bool {
+	if pattern == contentType {
+		return true
+	}
+	prefix := strings.TrimSuffix(pattern, "*")
+	return prefix != pattern && strings.HasPrefix(contentType, prefix)
+}
@@ -0,0 +1,477 @@
+// Package pinata is a small client for the Pinata pinning API.
+package pinata
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultBaseURL is the public Pinata API endpoint.
+	DefaultBaseURL = "https://api.pinata.cloud"
+
+	defaultMaxRetries = 3
+	defaultRetryDelay = 500 * time.Millisecond
+	// DefaultMaxRetryDelay caps how long a Retry-After header can make
+	// PinFile wait between attempts.
+	DefaultMaxRetryDelay = 30 * time.Second
+	defaultTimeout       = 60 * time.Second
+)
+
+// Client talks to the Pinata API with a single set of credentials.
+type Client struct {
+	apiKey        string
+	secret        string
+	jwt           string
+	baseURL       string
+	httpClient    *http.Client
+	maxRetries    int
+	retryDelay    time.Duration
+	maxRetryDelay time.Duration
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient replaces the default HTTP client (60s timeout).
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithJWT authenticates with a bearer token instead of the key/secret pair.
+// Pinata recommends JWTs over legacy keys; when set it takes precedence.
+func WithJWT(jwt string) Option {
+	return func(c *Client) { c.jwt = jwt }
+}
+
+// WithBaseURL points the client at a different API endpoint, such as a
+// proxy or a local stub server in tests.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) { c.baseURL = strings.TrimSuffix(baseURL, "/") }
+}
+
+// WithMaxRetries sets how many times a transient PinFile failure is retried.
+func WithMaxRetries(n int) Option {
+	return func(c *Client) { c.maxRetries = n }
+}
+
+// WithMaxRetryDelay caps the wait a Retry-After header can ask for.
+func WithMaxRetryDelay(d time.Duration) Option {
+	return func(c *Client) { c.maxRetryDelay = d }
+}
+
+// NewClient returns a Client authenticating with a legacy API key/secret pair.
+func NewClient(apiKey, secret string, opts ...Option) *Client {
+	c := &Client{
+		apiKey:        apiKey,
+		secret:        secret,
+		baseURL:       DefaultBaseURL,
+		httpClient:    &http.Client{Timeout: defaultTimeout},
+		maxRetries:    defaultMaxRetries,
+		retryDelay:    defaultRetryDelay,
+		maxRetryDelay: DefaultMaxRetryDelay,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+type PinResponse struct {
+	IpfsHash  string `json:"IpfsHash"`
+	PinSize   int64  `json:"PinSize"`
+	Timestamp string `json:"Timestamp"`
+}
+
+// Metadata is sent as pinataMetadata so pins show up named and tagged in
+// the Pinata dashboard.
+type Metadata struct {
+	Name      string                 `json:"name,omitempty"`
+	KeyValues map[string]interface{} `json:"keyvalues,omitempty"`
+}
+
+// Options is sent as pinataOptions. Nil fields leave Pinata's defaults.
+type Options struct {
+	CIDVersion *int   `json:"cidVersion,omitempty"`
+	GroupID    string `json:"groupId,omitempty"`
+}
+
+func (o Options) isZero() bool {
+	return o.CIDVersion == nil && o.GroupID == ""
+}
+
+type PinListRow struct {
+	ID          string   `json:"id"`
+	IpfsPinHash string   `json:"ipfs_pin_hash"`
+	Size        int64    `json:"size"`
+	DatePinned  string   `json:"date_pinned"`
+	Metadata    Metadata `json:"metadata"`
+}
+
+type PinList struct {
+	Count int          `json:"count"`
+	Rows  []PinListRow `json:"rows"`
+}
+
+// AuthMethod reports which credentials the client sends: "jwt" or "api_key".
+func (c *Client) AuthMethod() string {
+	if c.jwt != "" {
+		return "jwt"
+	}
+	return "api_key"
+}
+
+// setAuth adds the account credentials to an outgoing request.
+func (c *Client) setAuth(req *http.Request) {
+	if c.jwt != "" {
+		req.Header.Set("Authorization", "Bearer "+c.jwt)
+		return
+	}
+	req.Header.Set("pinata_api_key", c.apiKey)
+	req.Header.Set("pinata_secret_api_key", c.secret)
+}
+
+// PinFile streams file to pinFileToIPFS and returns the resulting CID.
+// Transient failures are retried, rewinding file before every attempt.
+func (c *Client) PinFile(ctx context.Context, file io.ReadSeeker, filename string, metadata Metadata, opts Options) (string, error) {
+	if metadata.Name == "" {
+		metadata.Name = filename
+	}
+
+	return c.pinMultipart(ctx, metadata, opts, func(writer *multipart.Writer) error {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		part, err := writer.CreateFormFile("file", filename)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(part, file)
+		return err
+	})
+}
+
+// DirFile is one file of a directory pin.
+type DirFile struct {
+	// Path is relative to the directory root and uses forward slashes.
+	Path string
+	// Open is called once per attempt, so retries can stream the file again.
+	Open func() (io.ReadCloser, error)
+}
+
+// PinDirectory pins files as a single directory named dirName. Every part's
+// filename carries the dirName/ prefix, which makes Pinata wrap them in one
+// directory and return its CID.
+func (c *Client) PinDirectory(ctx context.Context, dirName string, files []DirFile, metadata Metadata, opts Options) (string, error) {
+	if metadata.Name == "" {
+		metadata.Name = dirName
+	}
+
+	return c.pinMultipart(ctx, metadata, opts, func(writer *multipart.Writer) error {
+		for _, f := range files {
+			if err := writeDirFile(writer, dirName, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func writeDirFile(writer *multipart.Writer, dirName string, f DirFile) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	part, err := writer.CreateFormFile("file", path.Join(dirName, f.Path))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, r)
+	return err
+}
+
+// pinMultipart posts to pinFileToIPFS with writeFiles producing the file
+// parts, retrying transient failures.
+func (c *Client) pinMultipart(ctx context.Context, metadata Metadata, opts Options, writeFiles func(*multipart.Writer) error) (string, error) {
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return "", err
+	}
+	var optionsJSON []byte
+	if !opts.isZero() {
+		if optionsJSON, err = json.Marshal(opts); err != nil {
+			return "", err
+		}
+	}
+
+	writeBody := func(writer *multipart.Writer) error {
+		if err := writer.WriteField("pinataMetadata", string(metadataJSON)); err != nil {
+			return err
+		}
+		if optionsJSON != nil {
+			if err := writer.WriteField("pinataOptions", string(optionsJSON)); err != nil {
+				return err
+			}
+		}
+		return writeFiles(writer)
+	}
+
+	var resp *http.Response
+	for attempt := 0; ; attempt++ {
+		resp, err = c.doPinMultipartRequest(ctx, writeBody)
+		if attempt >= c.maxRetries || !shouldRetry(resp, err) || ctx.Err() != nil {
+			break
+		}
+		delay := c.retryBackoff(attempt)
+		if resp != nil {
+			if d, ok := retryAfter(resp, time.Now()); ok {
+				delay = d
+				if delay > c.maxRetryDelay {
+					delay = c.maxRetryDelay
+				}
+			}
+			resp.Body.Close()
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var pinRes PinResponse
+	if err := decodeResponse(resp, &pinRes); err != nil {
+		return "", err
+	}
+	return pinRes.IpfsHash, nil
+}
+
+// doPinMultipartRequest sends a single pinFileToIPFS attempt.
+func (c *Client) doPinMultipartRequest(ctx context.Context, writeBody func(*multipart.Writer) error) (*http.Response, error) {
+	// Stream the multipart body through a pipe so files are never held
+	// in memory in full; the writer goroutine feeds the request as the
+	// HTTP client reads it.
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		if err := writeBody(writer); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(writer.Close())
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/pinning/pinFileToIPFS", pr)
+	if err != nil {
+		pr.CloseWithError(err)
+		<-done
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	c.setAuth(req)
+
+	resp, err := c.httpClient.Do(req)
+
+	// Make sure the writer goroutine has stopped reading before the next
+	// attempt rewinds or reopens the files.
+	pr.Close()
+	<-done
+
+	return resp, err
+}
+
+// shouldRetry reports whether an attempt failed transiently: network
+// errors, rate limiting and gateway-style 5xx responses.
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryBackoff doubles the delay on every attempt and picks a random
+// duration in its upper half so concurrent uploads don't retry in lockstep.
+func (c *Client) retryBackoff(attempt int) time.Duration {
+	d := c.retryDelay << attempt
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryAfter parses a Retry-After header given either in seconds or as an
+// HTTP date.
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// PinJSON pins an arbitrary JSON document and returns its CID.
+func (c *Client) PinJSON(ctx context.Context, content json.RawMessage, metadata Metadata) (string, error) {
+	payload, err := json.Marshal(struct {
+		PinataContent  json.RawMessage `json:"pinataContent"`
+		PinataMetadata *Metadata       `json:"pinataMetadata,omitempty"`
+	}{content, metadataOrNil(metadata)})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/pinning/pinJSONToIPFS", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var pinRes PinResponse
+	if err := c.do(req, &pinRes); err != nil {
+		return "", err
+	}
+	return pinRes.IpfsHash, nil
+}
+
+func metadataOrNil(metadata Metadata) *Metadata {
+	if metadata.Name == "" && len(metadata.KeyValues) == 0 {
+		return nil
+	}
+	return &metadata
+}
+
+// PinByHashResponse describes a pin request. Status is "pinned" when
+// Pinata already has the content, or a pending state such as "prechecking"
+// or "searching" while it is fetched from the network.
+type PinByHashResponse struct {
+	ID       string `json:"id"`
+	IpfsHash string `json:"ipfsHash"`
+	Status   string `json:"status"`
+	Name     string `json:"name"`
+}
+
+// PinByHash asks Pinata to pin content that is already on the IPFS network.
+// Pinata finishes the pin asynchronously unless it already holds the CID.
+func (c *Client) PinByHash(ctx context.Context, cid string, metadata Metadata) (*PinByHashResponse, error) {
+	payload, err := json.Marshal(struct {
+		HashToPin      string    `json:"hashToPin"`
+		PinataMetadata *Metadata `json:"pinataMetadata,omitempty"`
+	}{cid, metadataOrNil(metadata)})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/pinning/pinByHash", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var pinRes PinByHashResponse
+	if err := c.do(req, &pinRes); err != nil {
+		return nil, err
+	}
+	return &pinRes, nil
+}
+
+// Unpin removes a pin from the account.
+func (c *Client) Unpin(ctx context.Context, cid string) error {
+	req, err := http.NewRequestWithContext(ctx, "DELETE", c.baseURL+"/pinning/unpin/"+url.PathEscape(cid), nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, nil)
+}
+
+// ListPins queries pinList with the given filters, e.g. pageOffset,
+// pageLimit and status. Rows is never nil.
+func (c *Client) ListPins(ctx context.Context, query url.Values) (*PinList, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/data/pinList?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var pinList PinList
+	if err := c.do(req, &pinList); err != nil {
+		return nil, err
+	}
+	if pinList.Rows == nil {
+		pinList.Rows = []PinListRow{}
+	}
+	return &pinList, nil
+}
+
+// TestAuthentication checks the credentials against /data/testAuthentication.
+func (c *Client) TestAuthentication(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/data/testAuthentication", nil)
+	if err != nil {
+		return err
+	}
+	if err := c.do(req, nil); err != nil {
+		return fmt.Errorf("pinata authentication failed: %w", err)
+	}
+	return nil
+}
+
+// do authenticates and sends req, decoding a successful JSON response into
+// out when it is non-nil.
+func (c *Client) do(req *http.Request, out interface{}) error {
+	c.setAuth(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return decodeResponse(resp, out)
+}
+
+func decodeResponse(resp *http.Response, out interface{}) error {
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != 200 {
+		return newAPIError(resp.StatusCode, body)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
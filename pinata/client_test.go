@@ -0,0 +1,365 @@
+package pinata
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client for srv that doesn't retry, so failures
+// surface on the first attempt.
+func newTestClient(srv *httptest.Server, opts ...Option) *Client {
+	opts = append([]Option{WithBaseURL(srv.URL), WithMaxRetries(0)}, opts...)
+	return NewClient("key", "secret", opts...)
+}
+
+func TestPinFileSuccess(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/pinning/pinFileToIPFS" {
+			t.Errorf("path = %s, want /pinning/pinFileToIPFS", r.URL.Path)
+		}
+		if got := r.Header.Get("pinata_api_key"); got != "key" {
+			t.Errorf("pinata_api_key = %q, want key", got)
+		}
+		if got := r.FormValue("pinataMetadata"); got != `{"name":"hello.txt"}` {
+			t.Errorf("pinataMetadata = %s", got)
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			t.Fatalf("reading file part: %v", err)
+		}
+		body, _ := io.ReadAll(file)
+		if header.Filename != "hello.txt" || string(body) != "hello world" {
+			t.Errorf("file part = %q %q", header.Filename, body)
+		}
+		io.WriteString(w, `{"IpfsHash":"QmTest","PinSize":11}`)
+	}))
+	defer srv.Close()
+
+	cid, err := newTestClient(srv).PinFile(context.Background(), strings.NewReader("hello world"), "hello.txt", Metadata{}, Options{})
+	if err != nil {
+		t.Fatalf("PinFile: %v", err)
+	}
+	if cid != "QmTest" {
+		t.Errorf("cid = %q, want QmTest", cid)
+	}
+}
+
+func TestPinFileJWT(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer token" {
+			t.Errorf("Authorization = %q, want Bearer token", got)
+		}
+		if got := r.Header.Get("pinata_api_key"); got != "" {
+			t.Errorf("pinata_api_key = %q, want none with a JWT", got)
+		}
+		io.WriteString(w, `{"IpfsHash":"QmTest"}`)
+	}))
+	defer srv.Close()
+
+	if _, err := newTestClient(srv, WithJWT("token")).PinFile(context.Background(), strings.NewReader("x"), "x.txt", Metadata{}, Options{}); err != nil {
+		t.Fatalf("PinFile: %v", err)
+	}
+}
+
+func TestPinFileNon200(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"error":{"reason":"INVALID_CREDENTIALS","details":"bad key"}}`)
+	}))
+	defer srv.Close()
+
+	_, err := newTestClient(srv).PinFile(context.Background(), strings.NewReader("x"), "x.txt", Metadata{}, Options{})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want *APIError", err)
+	}
+	if apiErr.StatusCode != http.StatusUnauthorized || apiErr.Reason != "INVALID_CREDENTIALS" || apiErr.Details != "bad key" {
+		t.Errorf("APIError = %+v", apiErr)
+	}
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("errors.Is(err, ErrUnauthorized) = false for %v", err)
+	}
+}
+
+func TestPinFileMalformedJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"IpfsHash":`)
+	}))
+	defer srv.Close()
+
+	_, err := newTestClient(srv).PinFile(context.Background(), strings.NewReader("x"), "x.txt", Metadata{}, Options{})
+	if err == nil {
+		t.Fatal("PinFile succeeded on a malformed response")
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		t.Errorf("err = %v, want a decoding error rather than an APIError", err)
+	}
+}
+
+func TestPinFileNetworkFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	client := newTestClient(srv)
+	srv.Close()
+
+	if _, err := client.PinFile(context.Background(), strings.NewReader("x"), "x.txt", Metadata{}, Options{}); err == nil {
+		t.Fatal("PinFile succeeded against a closed server")
+	}
+}
+
+func TestPinFileRetriesTransientFailures(t *testing.T) {
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if _, _, err := r.FormFile("file"); err != nil {
+			t.Errorf("attempt %d: reading file part: %v", attempts, err)
+		}
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, `{"IpfsHash":"QmTest"}`)
+	}))
+	defer srv.Close()
+
+	client := NewClient("key", "secret", WithBaseURL(srv.URL), WithMaxRetries(1))
+	client.retryDelay = 0
+	cid, err := client.PinFile(context.Background(), strings.NewReader("x"), "x.txt", Metadata{}, Options{})
+	if err != nil || cid != "QmTest" {
+		t.Fatalf("PinFile = %q, %v; want QmTest", cid, err)
+	}
+	if attempts != 2 {
+		t.Errorf("attempts = %d, want 2", attempts)
+	}
+}
+
+func TestUnpinNotPinned(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" || r.URL.Path != "/pinning/unpin/QmTest" {
+			t.Errorf("request = %s %s", r.Method, r.URL.Path)
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error":{"reason":"CURRENT_USER_HAS_NOT_PINNED_CID"}}`)
+	}))
+	defer srv.Close()
+
+	if err := newTestClient(srv).Unpin(context.Background(), "QmTest"); !errors.Is(err, ErrNotPinned) {
+		t.Errorf("err = %v, want ErrNotPinned", err)
+	}
+}
+
+// zeroFile is a ReadSeeker of size zero bytes, standing in for a large
+// upload without holding it in memory.
+type zeroFile struct {
+	size, off int64
+}
+
+func (z *zeroFile) Read(p []byte) (int, error) {
+	if z.off >= z.size {
+		return 0, io.EOF
+	}
+	if rest := z.size - z.off; int64(len(p)) > rest {
+		p = p[:rest]
+	}
+	for i := range p {
+		p[i] = 0
+	}
+	z.off += int64(len(p))
+	return len(p), nil
+}
+
+func (z *zeroFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		z.off = offset
+	case io.SeekCurrent:
+		z.off += offset
+	case io.SeekEnd:
+		z.off = z.size + offset
+	}
+	return z.off, nil
+}
+
+// waitForGoroutines polls until at most n goroutines are running, as
+// goroutines that were told to stop may take a moment to exit.
+func waitForGoroutines(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > n {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			t.Fatalf("%d goroutines running, want at most %d:\n%s", runtime.NumGoroutine(), n, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestCancelStopsBodyWriter cancels each streaming upload while the server
+// is still reading it, and checks the goroutine feeding the pipe exits.
+func TestCancelStopsBodyWriter(t *testing.T) {
+	uploads := map[string]func(context.Context, *Client) error{
+		"PinFile": func(ctx context.Context, c *Client) error {
+			_, err := c.PinFile(ctx, &zeroFile{size: 1 << 30}, "big.bin", Metadata{}, Options{})
+			return err
+		},
+		"PinDirectory": func(ctx context.Context, c *Client) error {
+			open := func() (io.ReadCloser, error) { return io.NopCloser(&zeroFile{size: 1 << 30}), nil }
+			_, err := c.PinDirectory(ctx, "site", []DirFile{{Path: "a.bin", Open: open}, {Path: "b.bin", Open: open}}, Metadata{}, Options{})
+			return err
+		},
+	}
+	for name, upload := range uploads {
+		upload := upload
+		t.Run(name, func(t *testing.T) {
+			reading, release, handled := make(chan struct{}), make(chan struct{}), make(chan struct{})
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer close(handled)
+				// Take part of the body, then stall like a slow upstream.
+				io.CopyN(io.Discard, r.Body, 1<<20)
+				close(reading)
+				<-release
+			}))
+			defer srv.Close()
+
+			transport := &http.Transport{}
+			client := newTestClient(srv, WithHTTPClient(&http.Client{Transport: transport}))
+			baseline := runtime.NumGoroutine()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				<-reading
+				cancel()
+			}()
+			if err := upload(ctx, client); !errors.Is(err, context.Canceled) {
+				t.Fatalf("err = %v, want context.Canceled", err)
+			}
+
+			// Only the server's goroutines may outlive the upload; let them
+			// go too.
+			close(release)
+			<-handled
+			transport.CloseIdleConnections()
+			srv.CloseClientConnections()
+			waitForGoroutines(t, baseline)
+		})
+	}
+}
+
+// TestPinFileStreamsLargeUploads sends 500MB through PinFile and checks
+// the heap never grows anywhere near the upload's size.
+func TestPinFileStreamsLargeUploads(t *testing.T) {
+	if testing.Short() {
+		t.Skip("streams 500MB")
+	}
+	const (
+		size      = 500 << 20
+		maxGrowth = 32 << 20
+	)
+
+	var received int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			t.Errorf("reading multipart body: %v", err)
+			return
+		}
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+			if part.FormName() == "file" {
+				received, _ = io.Copy(io.Discard, part)
+			}
+		}
+		io.WriteString(w, `{"IpfsHash":"QmTest"}`)
+	}))
+	defer srv.Close()
+
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	baseline := stats.HeapInuse
+
+	var peak uint64
+	stop, sampled := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(sampled)
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			var s runtime.MemStats
+			runtime.ReadMemStats(&s)
+			if s.HeapInuse > peak {
+				peak = s.HeapInuse
+			}
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	_, err := newTestClient(srv).PinFile(context.Background(), &zeroFile{size: size}, "big.bin", Metadata{}, Options{})
+	close(stop)
+	<-sampled
+	if err != nil {
+		t.Fatalf("PinFile: %v", err)
+	}
+	if received != size {
+		t.Errorf("server received %d bytes, want %d", received, size)
+	}
+	if growth := int64(peak) - int64(baseline); growth > maxGrowth {
+		t.Errorf("heap grew by %d MB while streaming, want at most %d MB", growth>>20, maxGrowth>>20)
+	}
+}
+
+// slowServer answers only after delay, or gives up once the client leaves.
+func slowServer(delay time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		select {
+		case <-time.After(delay):
+			io.WriteString(w, `{"IpfsHash":"QmTest"}`)
+		case <-r.Context().Done():
+		}
+	}))
+}
+
+func TestPinFileHTTPClientTimeout(t *testing.T) {
+	srv := slowServer(5 * time.Second)
+	defer srv.Close()
+
+	client := newTestClient(srv, WithHTTPClient(&http.Client{Timeout: 100 * time.Millisecond}))
+	start := time.Now()
+	_, err := client.PinFile(context.Background(), strings.NewReader("x"), "x.txt", Metadata{}, Options{})
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("err = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("PinFile took %s, want it cut off near the 100ms timeout", elapsed)
+	}
+}
+
+func TestPinFileContextDeadline(t *testing.T) {
+	srv := slowServer(5 * time.Second)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	// Retries are allowed here: an expired context must stop them too.
+	client := NewClient("key", "secret", WithBaseURL(srv.URL))
+	if _, err := client.PinFile(ctx, strings.NewReader("x"), "x.txt", Metadata{}, Options{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
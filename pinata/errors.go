@@ -0,0 +1,87 @@
+package pinata
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Sentinels an *APIError matches with errors.Is, so callers can branch on
+// the kind of failure without inspecting status codes.
+var (
+	// ErrUnauthorized means Pinata rejected the client's credentials.
+	ErrUnauthorized = errors.New("pinata: unauthorized")
+	// ErrRateLimited means Pinata kept answering 429 until retries ran out.
+	ErrRateLimited = errors.New("pinata: rate limited")
+	// ErrNotPinned means the account doesn't pin the CID, e.g. when
+	// unpinning it twice.
+	ErrNotPinned = errors.New("pinata: not pinned")
+)
+
+// APIError is returned for any non-200 response from Pinata. Reason and
+// Details come from Pinata's error envelope; Body keeps the raw response
+// for errors that don't use it.
+type APIError struct {
+	StatusCode int
+	Reason     string
+	Details    string
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	switch {
+	case e.Reason != "" && e.Details != "":
+		return fmt.Sprintf("pinata error (%d): %s: %s", e.StatusCode, e.Reason, e.Details)
+	case e.Reason != "":
+		return fmt.Sprintf("pinata error (%d): %s", e.StatusCode, e.Reason)
+	default:
+		return fmt.Sprintf("pinata error (%d): %s", e.StatusCode, e.Body)
+	}
+}
+
+// IsAuthError reports whether Pinata rejected the client's credentials.
+func (e *APIError) IsAuthError() bool {
+	return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+}
+
+// Is matches ErrUnauthorized and ErrRateLimited by status code, and
+// ErrNotPinned by Pinata's reason.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.IsAuthError()
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrNotPinned:
+		return e.Reason == "CURRENT_USER_HAS_NOT_PINNED_CID"
+	}
+	return false
+}
+
+// newAPIError parses body as {"error":{"reason":...,"details":...}}, also
+// accepting the {"error":"..."} form some endpoints use.
+func newAPIError(statusCode int, body []byte) *APIError {
+	apiErr := &APIError{StatusCode: statusCode, Body: string(body)}
+
+	var envelope struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(body, &envelope) != nil || len(envelope.Error) == 0 {
+		return apiErr
+	}
+
+	var detailed struct {
+		Reason  string `json:"reason"`
+		Details string `json:"details"`
+	}
+	if json.Unmarshal(envelope.Error, &detailed) == nil {
+		apiErr.Reason, apiErr.Details = detailed.Reason, detailed.Details
+		return apiErr
+	}
+	var reason string
+	if json.Unmarshal(envelope.Error, &reason) == nil {
+		apiErr.Reason = reason
+	}
+	return apiErr
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxTracedBody caps how much of a Pinata request or response body a debug
+// trace includes.
+const maxTracedBody = 4 << 10
+
+// pinataTraceTransport logs every Pinata API call: a one-line summary at
+// info, and at debug the full request and response with credentials
+// redacted. With DEBUG_CAPTURE_DIR it also saves each exchange to a file.
+type pinataTraceTransport struct {
+	base http.RoundTripper
+}
+
+func (t *pinataTraceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	capture := debugCaptureDir != ""
+	if !logEnabled("info") && !capture {
+		return t.base.RoundTrip(req)
+	}
+
+	fields := map[string]interface{}{
+		"request_id": requestIDFromContext(req.Context()),
+		"method":     req.Method,
+		"path":       req.URL.Path,
+	}
+	debug := logEnabled("debug")
+	if debug || capture {
+		fields["url"] = req.URL.String()
+		fields["request_headers"] = redactedHeaders(req.Header)
+		fields["request_body"] = tracedRequestBody(req)
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	fields["latency_ms"] = time.Since(start).Milliseconds()
+	if err != nil {
+		fields["error"] = err.Error()
+		logEvent("info", "pinata request failed", summaryFields(fields, debug))
+		if capture {
+			captureExchange(req.Context(), fields)
+		}
+		return nil, err
+	}
+	fields["status"] = resp.StatusCode
+
+	if debug || capture {
+		fields["response_headers"] = redactedHeaders(resp.Header)
+		// Pinata answers with small JSON documents, so the body is read in
+		// full and handed back to the client untouched.
+		body, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		fields["response_body"] = truncateTrace(body)
+		if readErr != nil {
+			fields["error"] = readErr.Error()
+		}
+	}
+	if debug {
+		logEvent("debug", "pinata request", fields)
+	} else {
+		logEvent("info", "pinata request", summaryFields(fields, false))
+	}
+	if capture {
+		captureExchange(req.Context(), fields)
+	}
+	return resp, nil
+}
+
+// summaryFields drops the detail gathered for a debug trace or a capture
+// unless debug logging wants it.
+func summaryFields(fields map[string]interface{}, debug bool) map[string]interface{} {
+	if debug {
+		return fields
+	}
+	summary := map[string]interface{}{}
+	for _, k := range []string{"request_id", "method", "path", "status", "latency_ms", "error"} {
+		if v, ok := fields[k]; ok {
+			summary[k] = v
+		}
+	}
+	return summary
+}
+
+// tracedRequestBody reads a copy of a replayable body (the JSON endpoints).
+// Multipart uploads are streamed once and are left out.
+func tracedRequestBody(req *http.Request) string {
+	if req.Body == nil || req.Body == http.NoBody {
+		return ""
+	}
+	if req.GetBody == nil {
+		return "(streamed body omitted)"
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return ""
+	}
+	defer body.Close()
+	b, _ := io.ReadAll(io.LimitReader(body, maxTracedBody+1))
+	return truncateTrace(b)
+}
+
+func truncateTrace(b []byte) string {
+	if len(b) > maxTracedBody {
+		return string(b[:maxTracedBody]) + "...(truncated)"
+	}
+	return string(b)
+}
+
+// redactedHeaders flattens h for logging with redactedValue.
+func redactedHeaders(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for name, values := range h {
+		out[name] = redactedValue(name, strings.Join(values, ", "))
+	}
+	return out
+}
+
+// redactedValue masks the value of anything named like a credential:
+// Authorization and cookies, Pinata's key/secret headers, or any name
+// ending in "key" or mentioning an API key, secret, token, JWT or password.
+func redactedValue(name, value string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case lower == "authorization", lower == "cookie", lower == "set-cookie",
+		strings.HasSuffix(lower, "key"), strings.Contains(lower, "apikey"),
+		strings.Contains(lower, "api_key"), strings.Contains(lower, "api-key"),
+		strings.Contains(lower, "secret"), strings.Contains(lower, "token"),
+		strings.Contains(lower, "jwt"), strings.Contains(lower, "password"):
+		return "[REDACTED]"
+	}
+	return value
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// pinNameTemplate, from PIN_NAME_TEMPLATE, names pins whose client sent no
+// name, e.g. "{timestamp}-{filename}". See expandPinName for the tokens.
+var pinNameTemplate string
+
+var pinNameToken = regexp.MustCompile(`\{[^{}]*\}`)
+
+var pinNameTokens = map[string]bool{
+	"{filename}":    true,
+	"{timestamp}":   true,
+	"{sha256short}": true,
+	"{uuid}":        true,
+}
+
+// parsePinNameTemplate rejects templates using tokens expandPinName doesn't
+// know, so a typo fails at startup instead of leaking into pin names.
+func parsePinNameTemplate(v string) error {
+	for _, token := range pinNameToken.FindAllString(v, -1) {
+		if !pinNameTokens[token] {
+			return fmt.Errorf("unknown token %s; use {filename}, {timestamp}, {sha256short} or {uuid}", token)
+		}
+	}
+	return nil
+}
+
+// expandPinName fills in {filename}, {timestamp} (UTC, like
+// 20261014T070905Z), {sha256short} (the first 8 hex digits of the
+// content's SHA-256) and {uuid} (a fresh random UUID).
+func expandPinName(template, filename, sum string, now time.Time) string {
+	short := sum
+	if len(short) > 8 {
+		short = short[:8]
+	}
+	return strings.NewReplacer(
+		"{filename}", filename,
+		"{timestamp}", now.UTC().Format("20060102T150405Z"),
+		"{sha256short}", short,
+		"{uuid}", uuid.NewString(),
+	).Replace(template)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultPinWaitTimeout = 30 * time.Second
+	pinWaitPollInterval   = 2 * time.Second
+)
+
+// waitForPin, from WAIT_FOR_PIN, holds each upload's response until the
+// pin is confirmed: through the backend when it can report pins, otherwise
+// by the gateway answering for the CID. pinWaitTimeout comes from
+// PIN_WAIT_TIMEOUT.
+var (
+	waitForPin     bool
+	pinWaitTimeout = defaultPinWaitTimeout
+)
+
+var errPinUnconfirmed = errors.New("pin was not confirmed before PIN_WAIT_TIMEOUT")
+
+// awaitPin polls until cid is confirmed pinned, returning errPinUnconfirmed
+// once pinWaitTimeout passes. checker is the backend holding the pin; nil
+// falls back to asking the gateway.
+func awaitPin(ctx context.Context, checker pinChecker, cid string) error {
+	ctx, cancel := context.WithTimeout(ctx, pinWaitTimeout)
+	defer cancel()
+
+	for {
+		if pinConfirmed(ctx, checker, cid) {
+			return nil
+		}
+		select {
+		case <-time.After(pinWaitPollInterval):
+		case <-ctx.Done():
+			return errPinUnconfirmed
+		}
+	}
+}
+
+// pinConfirmed makes one check; errors count as not confirmed yet.
+func pinConfirmed(ctx context.Context, checker pinChecker, cid string) bool {
+	if checker != nil {
+		pinned, err := checker.IsPinned(ctx, cid)
+		return err == nil && pinned
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "HEAD", gatewayURL(cid), nil)
+	if err != nil {
+		return false
+	}
+	resp, err := fetchClient.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2/utils"
+
+	"ipfs-fiber-uploader/pinata"
+)
+
+// compressBeforePin, from COMPRESS_BEFORE_PIN, gzips compressible uploads
+// before pinning them. The pin's keyvalues record content_encoding=gzip and
+// the original_content_type, which the /cid/ proxy uses to serve the
+// content decoded.
+var compressBeforePin bool
+
+// gzipPins remembers, per CID, the original content type of content pinned
+// gzipped, or "" for content that wasn't, so the proxy only asks Pinata
+// once per CID.
+var gzipPins = newDedupCache(defaultDedupCacheSize)
+
+// compressibleType reports whether content of this type is worth gzipping.
+// Everything else, including already compressed media, is left alone.
+func compressibleType(contentType string) bool {
+	switch {
+	case strings.HasPrefix(contentType, "text/"),
+		strings.HasSuffix(contentType, "+json"),
+		strings.HasSuffix(contentType, "+xml"):
+		return true
+	}
+	switch contentType {
+	case "application/json", "application/xml", "application/javascript", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// uploadContentType is the declared type of an upload, or the sniffed one
+// when the client sent none.
+func uploadContentType(file multipart.File, fileHeader *multipart.FileHeader) (string, error) {
+	if mediaType, _, err := mime.ParseMediaType(fileHeader.Header.Get("Content-Type")); err == nil && mediaType != "application/octet-stream" {
+		return mediaType, nil
+	}
+	return sniffContentType(file)
+}
+
+// gzipUpload returns a gzipped copy of file with a header carrying its new
+// size, plus the original content type, when file is compressible and
+// shrinks. Otherwise it returns file itself and "". The copy is streamed
+// into spoolDir; cleanup removes it and must always be called.
+func gzipUpload(file multipart.File, fileHeader *multipart.FileHeader) (multipart.File, *multipart.FileHeader, string, func(), error) {
+	noop := func() {}
+
+	contentType, err := uploadContentType(file, fileHeader)
+	if err != nil {
+		return nil, nil, "", noop, err
+	}
+	if !compressibleType(contentType) {
+		return file, fileHeader, "", noop, nil
+	}
+
+	spool, err := os.CreateTemp(spoolDir, "ipfs-gzip-*")
+	if err != nil {
+		return nil, nil, "", noop, err
+	}
+	cleanup := func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}
+
+	// A zero header keeps the output, and so the CID, identical for
+	// identical input.
+	zw := gzip.NewWriter(spool)
+	_, err = io.Copy(zw, io.NewSectionReader(file, 0, fileHeader.Size))
+	if err == nil {
+		err = zw.Close()
+	}
+	var size int64
+	if err == nil {
+		size, err = spool.Seek(0, io.SeekCurrent)
+	}
+	if err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		cleanup()
+		return nil, nil, "", noop, err
+	}
+
+	if size >= fileHeader.Size {
+		cleanup()
+		return file, fileHeader, "", noop, nil
+	}
+	compressed := &multipart.FileHeader{Filename: fileHeader.Filename, Size: size, Header: fileHeader.Header}
+	return spool, compressed, contentType, cleanup, nil
+}
+
+// gzipMetadata records in a pin's keyvalues that its content is gzipped.
+func gzipMetadata(metadata pinata.Metadata, originalType string) pinata.Metadata {
+	return withKeyValues(metadata, map[string]interface{}{
+		"content_encoding":      "gzip",
+		"original_content_type": originalType,
+	})
+}
+
+// gzipPinType returns the original content type of cid when it was pinned
+// gzipped, and false when it wasn't or the backend can't tell.
+func gzipPinType(ctx context.Context, cid string) (string, bool) {
+	if !compressBeforePin {
+		return "", false
+	}
+	if originalType, ok := gzipPins.get(cid); ok {
+		return originalType, originalType != ""
+	}
+
+	finder, ok := pinner.(pinFinder)
+	if !ok {
+		return "", false
+	}
+	pin, err := finder.FindPin(ctx, cid)
+	if err != nil {
+		return "", false
+	}
+	var originalType string
+	if pin != nil && pin.Metadata.KeyValues["content_encoding"] == "gzip" {
+		originalType, _ = pin.Metadata.KeyValues["original_content_type"].(string)
+		if originalType == "" {
+			originalType = "application/octet-stream"
+		}
+	}
+	// cid may point into fiber's request buffer, which is reused.
+	gzipPins.add(utils.CopyString(cid), originalType)
+	return originalType, originalType != ""
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	progressInterval = 250 * time.Millisecond
+	// progressRetention is how long a finished upload's result stays
+	// available for a subscriber that hasn't connected yet.
+	progressRetention = time.Minute
+)
+
+// uploadProgress tracks one asynchronous upload started with ?progress=true.
+type uploadProgress struct {
+	total   int64
+	sent    int64         // updated atomically by progressFile
+	updates chan struct{} // poked (never blocking) whenever sent changes
+	done    chan struct{} // closed once result is set
+	result  uploadResult
+}
+
+var (
+	progressMu  sync.Mutex
+	progressMap = map[string]*uploadProgress{}
+)
+
+func newUploadProgress(id string, total int64) *uploadProgress {
+	p := &uploadProgress{
+		total:   total,
+		updates: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+
+	progressMu.Lock()
+	progressMap[id] = p
+	progressMu.Unlock()
+	return p
+}
+
+func lookupUploadProgress(id string) *uploadProgress {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	return progressMap[id]
+}
+
+func removeUploadProgress(id string) {
+	progressMu.Lock()
+	delete(progressMap, id)
+	progressMu.Unlock()
+}
+
+func (p *uploadProgress) finish(result uploadResult) {
+	p.result = result
+	close(p.done)
+}
+
+// progressFile counts bytes read from the spooled upload. Rewinding for a
+// retry resets the count so the reported progress stays truthful.
+type progressFile struct {
+	*os.File
+	progress *uploadProgress
+}
+
+func (f *progressFile) Read(b []byte) (int, error) {
+	n, err := f.File.Read(b)
+	if n > 0 {
+		atomic.AddInt64(&f.progress.sent, int64(n))
+		select {
+		case f.progress.updates <- struct{}{}:
+		default:
+		}
+	}
+	return n, err
+}
+
+func (f *progressFile) Seek(offset int64, whence int) (int64, error) {
+	pos, err := f.File.Seek(offset, whence)
+	if err == nil {
+		atomic.StoreInt64(&f.progress.sent, pos)
+	}
+	return pos, err
+}
+
+// startAsyncUpload spools the file to disk and queues its upload on the
+// worker pool, reporting progress under the job's ID.
+func startAsyncUpload(c *fiber.Ctx, file multipart.File, fileHeader *multipart.FileHeader, opts uploadOptions) error {
+	spool, err := spoolUpload(file)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	id := uuid.NewString()
+	progress := newUploadProgress(id, fileHeader.Size)
+	header := &multipart.FileHeader{Filename: fileHeader.Filename, Size: fileHeader.Size, Header: fileHeader.Header}
+
+	_, err = enqueueJob(id, requestIDFromContext(c.Context()), func(ctx context.Context) (uploadResult, error) {
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+
+		result, err := uploadToIPFS(ctx, &progressFile{File: spool, progress: progress}, header, opts)
+		if err != nil {
+			result = uploadResult{Filename: header.Filename, Error: err.Error()}
+		}
+		progress.finish(result)
+
+		time.AfterFunc(progressRetention, func() { removeUploadProgress(id) })
+		if err != nil {
+			return uploadResult{Filename: header.Filename}, err
+		}
+		return result, nil
+	})
+	if err != nil {
+		removeUploadProgress(id)
+		spool.Close()
+		os.Remove(spool.Name())
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"upload_id":    id,
+		"progress_url": "/upload/" + id + "/progress",
+	})
+}
+
+// uploadProgressHandler streams Server-Sent Events for an async upload:
+// "progress" events with bytes sent, then a final "done" or "error" event.
+func uploadProgressHandler(c *fiber.Ctx) error {
+	id := c.Params("id")
+	progress := lookupUploadProgress(id)
+	if progress == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "unknown upload id"})
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-progress.done:
+				event := "done"
+				if progress.result.Error != "" {
+					event = "error"
+				}
+				writeSSE(w, event, progress.result)
+				removeUploadProgress(id)
+				return
+			case <-progress.updates:
+			case <-ticker.C:
+			}
+
+			sent := atomic.LoadInt64(&progress.sent)
+			if sent > progress.total {
+				sent = progress.total
+			}
+			// A failed flush means the client went away.
+			if err := writeSSE(w, "progress", fiber.Map{"bytes": sent, "total": progress.total}); err != nil {
+				removeUploadProgress(id)
+				return
+			}
+		}
+	})
+	return nil
+}
+
+func writeSSE(w *bufio.Writer, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return w.Flush()
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// selfTestPollInterval is how often the gateway is retried while it has not
+// yet picked up the freshly pinned file.
+const selfTestPollInterval = 2 * time.Second
+
+// runSelfTest pins a small random file through the configured provider,
+// fetches it back from the gateway and checks the bytes match, printing one
+// line per step. It exits non-zero if any step fails.
+func runSelfTest(args []string) {
+	flags := flag.NewFlagSet("selftest", flag.ExitOnError)
+	unpin := flags.Bool("unpin", false, "unpin the test file once it has been verified")
+	timeout := flags.Duration("timeout", 2*time.Minute, "how long to wait for the gateway to serve the test file")
+	flags.Parse(args)
+
+	validateConfig()
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	content := []byte("ipfs-fiber-uploader self-test " + hex.EncodeToString(nonce) + "\n")
+	name := "selftest-" + hex.EncodeToString(nonce[:4]) + ".txt"
+
+	ctx, cancel := context.WithTimeout(context.Background(), pinataTimeout)
+	start := time.Now()
+	cid, err := pinner.Pin(ctx, bytes.NewReader(content), name)
+	cancel()
+	if err != nil {
+		failSelfTest("pin", err)
+	}
+	fmt.Printf("✅ pin    %s via %s (%s)\n", cid, storageProvider, time.Since(start).Round(time.Millisecond))
+
+	start = time.Now()
+	fetched, err := fetchSelfTestFile(cid, *timeout)
+	if err != nil {
+		failSelfTest("fetch", err)
+	}
+	fmt.Printf("✅ fetch  %s (%s)\n", gatewayURL(cid), time.Since(start).Round(time.Millisecond))
+
+	if !bytes.Equal(fetched, content) {
+		failSelfTest("verify", fmt.Errorf("gateway returned %d bytes that differ from the %d pinned", len(fetched), len(content)))
+	}
+	fmt.Println("✅ verify content matches")
+
+	if *unpin {
+		u, ok := pinner.(unpinner)
+		if !ok {
+			failSelfTest("unpin", fmt.Errorf("%s does not support unpinning", storageProvider))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), pinataTimeout)
+		err := u.Unpin(ctx, cid)
+		cancel()
+		if err != nil {
+			failSelfTest("unpin", err)
+		}
+		fmt.Println("✅ unpin  done")
+	}
+
+	fmt.Println("🎉 Self-test passed")
+}
+
+func failSelfTest(step string, err error) {
+	fmt.Printf("❌ %-6s %v\n", step, err)
+	fmt.Println("💥 Self-test failed")
+	os.Exit(1)
+}
+
+// fetchSelfTestFile polls the gateway for cid until it answers 200 or
+// timeout passes, as a new pin can take a while to become retrievable.
+func fetchSelfTestFile(cid string, timeout time.Duration) ([]byte, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		data, err := fetchGatewayOnce(cid)
+		if err == nil {
+			return data, nil
+		}
+		if time.Now().Add(selfTestPollInterval).After(deadline) {
+			return nil, err
+		}
+		time.Sleep(selfTestPollInterval)
+	}
+}
+
+func fetchGatewayOnce(cid string) ([]byte, error) {
+	resp, err := fetchClient.Get(gatewayURL(cid))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("gateway returned %d", resp.StatusCode)
+	}
+	// The test file is tiny; anything much larger is not it.
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("reading gateway response: %w", err)
+	}
+	return data, nil
+}
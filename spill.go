@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	defaultInlineThreshold = 8 << 20
+	spillPattern           = "ipfs-spill-*"
+)
+
+// inlineThreshold, from INLINE_THRESHOLD, is the largest upload kept in
+// memory while it is pinned; bigger ones are spilled to uploadTmpDir
+// (UPLOAD_TMP_DIR) and streamed to the backend from disk.
+var (
+	inlineThreshold int64 = defaultInlineThreshold
+	uploadTmpDir    string
+)
+
+var (
+	spillMu    sync.Mutex
+	spillFiles = map[string]*os.File{}
+)
+
+// processStart dates the spill files of this process: anything older in
+// uploadTmpDir was left behind by an earlier run.
+var processStart = time.Now()
+
+// prepareUploadTmpDir creates uploadTmpDir if needed and checks it is
+// writable.
+func prepareUploadTmpDir() error {
+	dir := uploadTmpDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	probe, err := os.CreateTemp(dir, spillPattern)
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return nil
+}
+
+// sweepStaleSpills removes spill files a previous run left in uploadTmpDir.
+// It only sweeps a dedicated UPLOAD_TMP_DIR, never the shared system temp
+// dir, and only files last modified before this process started, so a spill
+// another instance is still writing is left alone. selftest never sweeps.
+func sweepStaleSpills() {
+	if uploadTmpDir == "" {
+		return
+	}
+	stale, _ := filepath.Glob(filepath.Join(uploadTmpDir, spillPattern))
+	for _, path := range stale {
+		if info, err := os.Stat(path); err == nil && info.ModTime().Before(processStart) {
+			os.Remove(path)
+		}
+	}
+}
+
+// spillLargeUpload returns file unchanged when it is within inlineThreshold
+// or already on disk, and otherwise a copy in uploadTmpDir. cleanup removes
+// the copy and must always be called.
+func spillLargeUpload(file multipart.File, fileHeader *multipart.FileHeader) (multipart.File, func(), error) {
+	noop := func() {}
+	if _, onDisk := file.(*os.File); onDisk || fileHeader.Size <= inlineThreshold {
+		return file, noop, nil
+	}
+
+	spill, err := os.CreateTemp(uploadTmpDir, spillPattern)
+	if err != nil {
+		return nil, noop, err
+	}
+	spillMu.Lock()
+	spillFiles[spill.Name()] = spill
+	spillMu.Unlock()
+	cleanup := func() { removeSpill(spill) }
+
+	if _, err := io.Copy(spill, io.NewSectionReader(file, 0, fileHeader.Size)); err != nil {
+		cleanup()
+		return nil, noop, err
+	}
+	if _, err := spill.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return nil, noop, err
+	}
+	return spill, cleanup, nil
+}
+
+func removeSpill(spill *os.File) {
+	spillMu.Lock()
+	delete(spillFiles, spill.Name())
+	spillMu.Unlock()
+
+	spill.Close()
+	os.Remove(spill.Name())
+}
+
+// removeAllSpills deletes spill files still open at shutdown, such as those
+// of uploads cut off by the shutdown timeout.
+func removeAllSpills() {
+	spillMu.Lock()
+	files := make([]*os.File, 0, len(spillFiles))
+	for _, f := range spillFiles {
+		files = append(files, f)
+	}
+	spillMu.Unlock()
+
+	for _, f := range files {
+		removeSpill(f)
+	}
+}
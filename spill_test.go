@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSpill creates a spill-named file in dir last modified at mtime.
+func writeSpill(t *testing.T, dir, name string, mtime time.Time) string {
+	t.Helper()
+	path := filepath.Join(dir, "ipfs-spill-"+name)
+	if err := os.WriteFile(path, []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestSweepStaleSpills(t *testing.T) {
+	dir := t.TempDir()
+	uploadTmpDir = dir
+	t.Cleanup(func() { uploadTmpDir = "" })
+
+	stale := writeSpill(t, dir, "stale", processStart.Add(-time.Hour))
+	live := writeSpill(t, dir, "live", time.Now().Add(time.Minute))
+	if err := prepareUploadTmpDir(); err != nil {
+		t.Fatal(err)
+	}
+	if !exists(stale) {
+		t.Fatal("prepareUploadTmpDir removed a spill file; only the server's sweep may")
+	}
+
+	sweepStaleSpills()
+	if exists(stale) {
+		t.Error("spill file from before the process started was kept")
+	}
+	if !exists(live) {
+		t.Error("spill file newer than the process was removed")
+	}
+}
+
+func TestSweepStaleSpillsLeavesSystemTempDir(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+	uploadTmpDir = ""
+
+	stale := writeSpill(t, dir, "shared", processStart.Add(-time.Hour))
+	sweepStaleSpills()
+	if !exists(stale) {
+		t.Error("swept the shared system temp dir")
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"ipfs-fiber-uploader/pinata"
+)
+
+// Pinner is a storage backend that pins content to IPFS.
+type Pinner interface {
+	Pin(ctx context.Context, file io.ReadSeeker, name string) (cid string, err error)
+}
+
+// metadataPinner is implemented by backends that can also store the
+// name/keyvalues metadata sent with an upload and honour pin options.
+type metadataPinner interface {
+	PinWithMetadata(ctx context.Context, file io.ReadSeeker, name string, metadata pinata.Metadata, opts pinata.Options) (cid string, err error)
+}
+
+// unpinner is implemented by backends that can remove a pin again.
+type unpinner interface {
+	Unpin(ctx context.Context, cid string) error
+}
+
+// errNotPinned is wrapped by backends other than Pinata, which has its own
+// pinata.ErrNotPinned, when asked to unpin a CID they don't pin.
+var errNotPinned = errors.New("not pinned")
+
+// isNotPinned reports whether an Unpin failed only because the CID was not
+// pinned to begin with.
+func isNotPinned(err error) bool {
+	return errors.Is(err, errNotPinned) || errors.Is(err, pinata.ErrNotPinned)
+}
+
+// pinChecker is implemented by backends that can confirm a pin is in place.
+type pinChecker interface {
+	IsPinned(ctx context.Context, cid string) (bool, error)
+}
+
+// pinFinder is implemented by backends that keep metadata with their pins.
+type pinFinder interface {
+	FindPin(ctx context.Context, cid string) (*pinata.PinListRow, error)
+}
+
+// jsonPinner is implemented by backends that can pin a JSON document.
+type jsonPinner interface {
+	PinJSON(ctx context.Context, content json.RawMessage, metadata pinata.Metadata) (cid string, err error)
+}
+
+// healthChecker is implemented by backends that can tell the deep health
+// check whether they are reachable and accept the server's credentials.
+type healthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
+// directoryPinner is implemented by backends that can pin several files
+// as one directory.
+type directoryPinner interface {
+	PinDirectory(ctx context.Context, dirName string, files []pinata.DirFile, metadata pinata.Metadata, opts pinata.Options) (cid string, err error)
+}
+
+// hashPinner is implemented by backends that can pin a CID already on the
+// network.
+type hashPinner interface {
+	PinByHash(ctx context.Context, cid string, metadata pinata.Metadata) (*pinata.PinByHashResponse, error)
+}
+
+// pinLister is implemented by backends that can page through their pins.
+type pinLister interface {
+	ListPins(ctx context.Context, offset, limit int, status string) (*pinata.PinList, error)
+}
+
+// namePublisher is implemented by backends that can publish a CID under
+// an IPNS name. Pinata has no IPNS publishing API, so only Kubo does.
+type namePublisher interface {
+	Publish(ctx context.Context, cid string) (name string, err error)
+}
+
+// PinataPinner pins through the Pinata API, rotating round-robin through
+// one client per configured account.
+type PinataPinner struct {
+	clients []*pinata.Client
+	next    uint32
+}
+
+func (p *PinataPinner) Pin(ctx context.Context, file io.ReadSeeker, name string) (string, error) {
+	return p.PinWithMetadata(ctx, file, name, pinata.Metadata{}, pinata.Options{})
+}
+
+func (p *PinataPinner) PinWithMetadata(ctx context.Context, file io.ReadSeeker, name string, metadata pinata.Metadata, opts pinata.Options) (cid string, err error) {
+	err = p.rotate(ctx, func(client *pinata.Client) error {
+		cid, err = client.PinFile(ctx, file, name, metadata, opts)
+		return err
+	})
+	return cid, err
+}
+
+func (p *PinataPinner) PinDirectory(ctx context.Context, dirName string, files []pinata.DirFile, metadata pinata.Metadata, opts pinata.Options) (cid string, err error) {
+	err = p.rotate(ctx, func(client *pinata.Client) error {
+		cid, err = client.PinDirectory(ctx, dirName, files, metadata, opts)
+		return err
+	})
+	return cid, err
+}
+
+func (p *PinataPinner) PinJSON(ctx context.Context, content json.RawMessage, metadata pinata.Metadata) (cid string, err error) {
+	err = p.rotate(ctx, func(client *pinata.Client) error {
+		cid, err = client.PinJSON(ctx, content, metadata)
+		return err
+	})
+	return cid, err
+}
+
+func (p *PinataPinner) PinByHash(ctx context.Context, cid string, metadata pinata.Metadata) (pin *pinata.PinByHashResponse, err error) {
+	err = p.rotate(ctx, func(client *pinata.Client) error {
+		pin, err = client.PinByHash(ctx, cid, metadata)
+		return err
+	})
+	return pin, err
+}
+
+// rotate pins with the next account in turn. An account that is still rate
+// limited once its own retries are spent hands the pin to the following
+// one, until every account has been tried.
+func (p *PinataPinner) rotate(ctx context.Context, pin func(*pinata.Client) error) error {
+	start := int(atomic.AddUint32(&p.next, 1)-1) % len(p.clients)
+	for i := 0; ; i++ {
+		account := (start + i) % len(p.clients)
+		logEvent("debug", "pinning with pinata account", map[string]interface{}{
+			"request_id": requestIDFromContext(ctx),
+			"account":    account + 1,
+			"accounts":   len(p.clients),
+		})
+
+		err := pin(p.clients[account])
+		if i == len(p.clients)-1 || !errors.Is(err, pinata.ErrRateLimited) {
+			return err
+		}
+	}
+}
+
+// Unpin removes cid from whichever account holds it, trying each in turn
+// since uploads are spread across all of them. It reports pinata.ErrNotPinned
+// only when every account answered that way.
+func (p *PinataPinner) Unpin(ctx context.Context, cid string) error {
+	var firstErr error
+	for _, client := range p.clients {
+		err := client.Unpin(ctx, cid)
+		if err == nil {
+			return nil
+		}
+		if firstErr == nil || isNotPinned(firstErr) && !isNotPinned(err) {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// CheckHealth tests every account's credentials, since any of them may be
+// handed the next upload.
+func (p *PinataPinner) CheckHealth(ctx context.Context) error {
+	for i, client := range p.clients {
+		if err := client.TestAuthentication(ctx); err != nil {
+			if len(p.clients) > 1 {
+				return fmt.Errorf("account %d: %w", i+1, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// IsPinned looks cid up in each account's pinList.
+func (p *PinataPinner) IsPinned(ctx context.Context, cid string) (bool, error) {
+	pin, err := p.FindPin(ctx, cid)
+	return pin != nil, err
+}
+
+// FindPin returns the pin of cid from whichever account holds it, or nil
+// when none does. hashContains matches substrings, so rows are checked for
+// the exact CID.
+func (p *PinataPinner) FindPin(ctx context.Context, cid string) (*pinata.PinListRow, error) {
+	query := url.Values{"hashContains": {cid}, "status": {"pinned"}, "pageLimit": {"10"}}
+	for _, client := range p.clients {
+		list, err := client.ListPins(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Rows {
+			if list.Rows[i].IpfsPinHash == cid {
+				return &list.Rows[i], nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// ListPins pages through the pins of every account as one list, the
+// accounts' pins following each other in order. Count is the total across
+// all of them.
+func (p *PinataPinner) ListPins(ctx context.Context, offset, limit int, status string) (*pinata.PinList, error) {
+	all := &pinata.PinList{Rows: []pinata.PinListRow{}}
+	for _, client := range p.clients {
+		// Pinata needs a page of at least one, even when only the count
+		// is still wanted.
+		pageLimit := limit - len(all.Rows)
+		if pageLimit < 1 {
+			pageLimit = 1
+		}
+		query := url.Values{
+			"pageOffset": {strconv.Itoa(offset)},
+			"pageLimit":  {strconv.Itoa(pageLimit)},
+			"status":     {status},
+		}
+		list, err := client.ListPins(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		all.Count += list.Count
+		if len(all.Rows) < limit {
+			all.Rows = append(all.Rows, list.Rows...)
+		}
+		if offset -= list.Count; offset < 0 {
+			offset = 0
+		}
+	}
+	return all, nil
+}
+
+// pinataClients holds a client per account from PINATA_API_KEY and
+// PINATA_SECRET_API_KEY. Pins rotate through them; what isn't tied to an
+// account, such as the startup auth log, uses pinataClient, the first.
+var pinataClients = []*pinata.Client{pinataClient}
+
+// parseCredentialList splits a credential variable holding either a JSON
+// array or a comma-separated list.
+func parseCredentialList(v string) ([]string, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return nil, nil
+	}
+
+	var list []string
+	if strings.HasPrefix(v, "[") {
+		if err := json.Unmarshal([]byte(v), &list); err != nil {
+			return nil, err
+		}
+	} else {
+		list = strings.Split(v, ",")
+	}
+	for i, s := range list {
+		list[i] = strings.TrimSpace(s)
+		if list[i] == "" {
+			return nil, errors.New("empty entry in list")
+		}
+	}
+	return list, nil
+}
+
+// storageProvider and pinner are selected by STORAGE_PROVIDER in loadEnv.
+var (
+	storageProvider        = "pinata"
+	pinner          Pinner = &PinataPinner{clients: pinataClients}
+)
+
+func newPinner(provider string) (Pinner, error) {
+	switch provider {
+	case "pinata":
+		return &PinataPinner{clients: pinataClients}, nil
+	case "kubo":
+		return &KuboPinner{apiURL: kuboAPIURL, httpClient: &http.Client{Timeout: pinataTimeout}}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage provider %q", provider)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"ipfs-fiber-uploader/pinata"
+)
+
+// pinataAccount serves pinList over pins CIDs named prefix-0, prefix-1, ...
+// and answers pinByHash with status.
+func pinataAccount(t *testing.T, prefix string, pins int, status int) *pinata.Client {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/data/pinList", func(w http.ResponseWriter, r *http.Request) {
+		offset, _ := strconv.Atoi(r.URL.Query().Get("pageOffset"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("pageLimit"))
+		list := pinata.PinList{Count: pins, Rows: []pinata.PinListRow{}}
+		for i := offset; i < pins && i < offset+limit; i++ {
+			list.Rows = append(list.Rows, pinata.PinListRow{IpfsPinHash: fmt.Sprintf("%s-%d", prefix, i)})
+		}
+		json.NewEncoder(w).Encode(list)
+	})
+	mux.HandleFunc("/pinning/pinByHash", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(pinata.PinByHashResponse{ID: prefix, Status: "searching"})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return pinata.NewClient("key", "secret", pinata.WithBaseURL(srv.URL), pinata.WithMaxRetries(0))
+}
+
+func TestPinataPinnerListPinsSpansAccounts(t *testing.T) {
+	p := &PinataPinner{clients: []*pinata.Client{
+		pinataAccount(t, "a", 3, http.StatusOK),
+		pinataAccount(t, "b", 4, http.StatusOK),
+	}}
+
+	tests := []struct {
+		offset, limit int
+		want          []string
+	}{
+		{0, 2, []string{"a-0", "a-1"}},
+		{2, 3, []string{"a-2", "b-0", "b-1"}},
+		{5, 10, []string{"b-2", "b-3"}},
+		{7, 10, nil},
+	}
+	for _, tt := range tests {
+		list, err := p.ListPins(context.Background(), tt.offset, tt.limit, "pinned")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, row := range list.Rows {
+			got = append(got, row.IpfsPinHash)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) || list.Count != 7 {
+			t.Errorf("offset %d limit %d: got %v (count %d), want %v (count 7)", tt.offset, tt.limit, got, list.Count, tt.want)
+		}
+	}
+}
+
+func TestPinataPinnerPinByHashRotates(t *testing.T) {
+	p := &PinataPinner{clients: []*pinata.Client{
+		pinataAccount(t, "a", 0, http.StatusTooManyRequests),
+		pinataAccount(t, "b", 0, http.StatusOK),
+	}}
+
+	pin, err := p.PinByHash(context.Background(), testCID, pinata.Metadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pin.ID != "b" {
+		t.Errorf("pinned with account %q, want the one that isn't rate limited", pin.ID)
+	}
+}
+
+func TestNewPinataClientsUsesParsedCredentials(t *testing.T) {
+	var gotKey, gotSecret string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey, gotSecret = r.Header.Get("pinata_api_key"), r.Header.Get("pinata_secret_api_key")
+		io.WriteString(w, `{"message":"Congratulations!"}`)
+	}))
+	defer srv.Close()
+	oldOptions := pinataOptions
+	pinataOptions = []pinata.Option{pinata.WithBaseURL(srv.URL), pinata.WithMaxRetries(0)}
+	t.Cleanup(func() { pinataOptions = oldOptions })
+
+	for _, tt := range []struct{ name, keys, secrets string }{
+		{"json array", `["k"]`, `["s"]`},
+		{"padded entry", "  k  ", " s "},
+	} {
+		keys, err := parseCredentialList(tt.keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		secrets, err := parseCredentialList(tt.secrets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clients := newPinataClients(keys, secrets, false)
+		if len(clients) != 1 {
+			t.Fatalf("%s: got %d clients, want 1", tt.name, len(clients))
+		}
+		if err := clients[0].TestAuthentication(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if gotKey != "k" || gotSecret != "s" {
+			t.Errorf("%s: sent key %q and secret %q, want k and s", tt.name, gotKey, gotSecret)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+
+	"ipfs-fiber-uploader/pinata"
+)
+
+const (
+	tenantJWTHeader    = "X-Pinata-JWT"
+	maxTenantJWTLength = 4096
+)
+
+// allowTenantCredentials, from ALLOW_TENANT_CREDENTIALS, lets a caller pin
+// uploads to their own Pinata account by sending its JWT in X-Pinata-JWT.
+// pinataOptions are the settings every client, including a tenant's, is
+// built with.
+var (
+	allowTenantCredentials bool
+	pinataOptions          []pinata.Option
+)
+
+// tenantAuthError is Pinata rejecting a caller's own JWT, as opposed to the
+// server's credentials.
+type tenantAuthError struct {
+	err *pinata.APIError
+}
+
+func (e *tenantAuthError) Error() string {
+	return fmt.Sprintf("pinata rejected the %s credentials: %v", tenantJWTHeader, e.err)
+}
+
+func (e *tenantAuthError) Unwrap() error { return e.err }
+
+// tenantClient returns a client for the JWT in X-Pinata-JWT, or nil when the
+// request carries none. The token is only ever sent to Pinata: it is kept
+// out of errors and logs.
+func tenantClient(c *fiber.Ctx) (*pinata.Client, error) {
+	// The client outlives the request for async uploads, and headers point
+	// into a buffer fiber reuses.
+	jwt := utils.CopyString(strings.TrimSpace(c.Get(tenantJWTHeader)))
+	if jwt == "" {
+		return nil, nil
+	}
+	if !allowTenantCredentials {
+		return nil, errors.New(tenantJWTHeader + " is not accepted by this server")
+	}
+	if len(jwt) > maxTenantJWTLength || strings.ContainsAny(jwt, " \t") {
+		return nil, fmt.Errorf("%s is not a valid JWT", tenantJWTHeader)
+	}
+	opts := append(append([]pinata.Option(nil), pinataOptions...), pinata.WithJWT(jwt))
+	return pinata.NewClient("", "", opts...), nil
+}
+
+// directoryPinner returns what a directory upload pins with: the caller's
+// own account when it sent credentials, otherwise the backend if it can
+// pin directories.
+func (o uploadOptions) directoryPinner() directoryPinner {
+	if o.tenant != nil {
+		return &PinataPinner{clients: []*pinata.Client{o.tenant}}
+	}
+	dirPinner, _ := pinner.(directoryPinner)
+	return dirPinner
+}
+
+// pinChecker returns what confirms an upload's pin: the caller's own
+// account when it sent credentials, since the server's accounts don't hold
+// those pins, otherwise the backend if it can report pins.
+func (o uploadOptions) pinChecker() pinChecker {
+	if o.tenant != nil {
+		return &PinataPinner{clients: []*pinata.Client{o.tenant}}
+	}
+	checker, _ := pinner.(pinChecker)
+	return checker
+}
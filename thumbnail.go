@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"io"
+	"mime/multipart"
+	"path/filepath"
+	"strings"
+
+	// Register the decoders image.Decode can pick from.
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	thumbnailMaxSide = 256
+	// thumbnailMaxPixels bounds the images we are willing to decode.
+	thumbnailMaxPixels = 50 << 20
+)
+
+// generateThumbnails, from GENERATE_THUMBNAILS, also pins a small JPEG
+// preview of every image uploaded through /upload.
+var generateThumbnails bool
+
+// thumbnailResult keeps the original's fields at the top level, where
+// clients that don't know about thumbnails already read them.
+type thumbnailResult struct {
+	uploadResult
+	Thumbnail uploadResult `json:"thumbnail"`
+}
+
+// pinThumbnail pins a thumbnail of the image in file. It reports false,
+// leaving the caller to answer with the original alone, when the content
+// isn't an image it can decode or the thumbnail couldn't be pinned.
+func pinThumbnail(ctx context.Context, file multipart.File, fileHeader *multipart.FileHeader, opts uploadOptions) (uploadResult, bool) {
+	thumb, err := makeThumbnail(io.NewSectionReader(file, 0, fileHeader.Size))
+	if err != nil {
+		return uploadResult{}, false
+	}
+
+	base := strings.TrimSuffix(fileHeader.Filename, filepath.Ext(fileHeader.Filename))
+	thumbHeader := newFileHeader("thumb_"+base+".jpg", int64(len(thumb)), "image/jpeg")
+	opts.metadata.Name = ""
+
+	result, err := uploadToIPFS(ctx, bytesFile{bytes.NewReader(thumb)}, thumbHeader, opts)
+	if err != nil {
+		logEvent("error", "thumbnail upload failed", map[string]interface{}{
+			"request_id": requestIDFromContext(ctx),
+			"filename":   fileHeader.Filename,
+			"error":      err.Error(),
+		})
+		return uploadResult{}, false
+	}
+	return result, true
+}
+
+// makeThumbnail decodes r and returns it scaled to fit within
+// thumbnailMaxSide pixels, encoded as JPEG.
+func makeThumbnail(r io.ReadSeeker) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > thumbnailMaxPixels {
+		return nil, image.ErrFormat
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > thumbnailMaxSide || h > thumbnailMaxSide {
+		if w >= h {
+			w, h = thumbnailMaxSide, h*thumbnailMaxSide/w
+		} else {
+			w, h = w*thumbnailMaxSide/h, thumbnailMaxSide
+		}
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+
+	// JPEG has no alpha, so composite transparent images onto white.
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
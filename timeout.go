@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// requestTimeout, from REQUEST_TIMEOUT, bounds how long an upload request
+// may spend in its handler. Zero leaves requests unbounded.
+var requestTimeout time.Duration
+
+// enforceRequestTimeout gives the rest of the chain a user context that is
+// cancelled after requestTimeout, which aborts any upload still running
+// under it. A request that ran out of time is answered with 503 whatever
+// the handler wrote. The user context comes from uploadContext, so the
+// request ID still reaches the logs and shutdown drains the upload instead
+// of aborting it.
+func enforceRequestTimeout(c *fiber.Ctx) error {
+	if requestTimeout <= 0 {
+		c.SetUserContext(uploadContext(c))
+		return c.Next()
+	}
+
+	ctx, cancel := context.WithTimeout(uploadContext(c), requestTimeout)
+	defer cancel()
+	c.SetUserContext(ctx)
+
+	err := c.Next()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		// Keep headers from earlier middleware such as CORS, but not the
+		// outcome of an upload that finished just before the deadline.
+		c.Response().ResetBody()
+		c.Response().Header.Del("X-IPFS-CID")
+		c.Response().Header.Del("X-Upload-Duration-Ms")
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "request timed out after " + requestTimeout.String(),
+		})
+	}
+	return err
+}
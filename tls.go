@@ -0,0 +1,52 @@
+package main
+
+import (
+	"crypto/tls"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const defaultTLSCacheDir = "./certs"
+
+// tlsCertFile and tlsKeyFile, from TLS_CERT_FILE and TLS_KEY_FILE, serve
+// HTTPS with a fixed certificate. tlsAutoDomain, from TLS_AUTO_DOMAIN,
+// instead obtains one from Let's Encrypt, caching it in tlsCacheDir
+// (TLS_CACHE_DIR).
+var (
+	tlsCertFile   string
+	tlsKeyFile    string
+	tlsAutoDomain string
+	tlsCacheDir   = defaultTLSCacheDir
+)
+
+func tlsEnabled() bool {
+	return tlsCertFile != "" || tlsAutoDomain != ""
+}
+
+// listen serves app on addr over HTTPS when TLS is configured and plain HTTP
+// otherwise. ACME certificates are validated with TLS-ALPN-01, so addr must
+// be reachable as port 443 of tlsAutoDomain.
+func listen(app *fiber.App, addr string) error {
+	switch {
+	case tlsAutoDomain != "":
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(tlsAutoDomain),
+			Cache:      autocert.DirCache(tlsCacheDir),
+		}
+		ln, err := tls.Listen("tcp", addr, &tls.Config{
+			GetCertificate: m.GetCertificate,
+			NextProtos:     []string{"http/1.1", acme.ALPNProto},
+		})
+		if err != nil {
+			return err
+		}
+		return app.Listener(ln)
+	case tlsCertFile != "":
+		return app.ListenTLS(addr, tlsCertFile, tlsKeyFile)
+	default:
+		return app.Listen(addr)
+	}
+}
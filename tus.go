@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/google/uuid"
+
+	"ipfs-fiber-uploader/pinata"
+)
+
+// The /files endpoints implement the core tus 1.0.0 protocol plus the
+// creation extension, so clients such as tus-js-client can resume large
+// uploads. Each upload is assembled in a temp file and pinned once its last
+// byte arrives; the final PATCH response carries the CID in Upload-CID.
+// Request bodies are buffered by Fiber, so clients should send chunks
+// (tus-js-client's chunkSize) for interrupted uploads to keep their progress.
+const (
+	tusVersion = "1.0.0"
+	// tusUploadExpiry is how long an unfinished upload is kept after its
+	// last PATCH.
+	tusUploadExpiry = 24 * time.Hour
+)
+
+type tusUpload struct {
+	mu       sync.Mutex
+	path     string
+	length   int64
+	offset   int64
+	metadata map[string]string
+	result   *uploadResult // set once the assembled file is pinned
+	expiry   *time.Timer
+}
+
+var (
+	tusMu      sync.Mutex
+	tusUploads = map[string]*tusUpload{}
+)
+
+func lookupTusUpload(id string) *tusUpload {
+	tusMu.Lock()
+	defer tusMu.Unlock()
+	return tusUploads[id]
+}
+
+func removeTusUpload(id string) {
+	tusMu.Lock()
+	u := tusUploads[id]
+	delete(tusUploads, id)
+	tusMu.Unlock()
+
+	if u != nil {
+		os.Remove(u.path)
+	}
+}
+
+// tusHeaders sets Tus-Resumable on every response and rejects requests
+// speaking another protocol version. OPTIONS is exempt, as the spec allows
+// clients to discover the version with it.
+func tusHeaders(c *fiber.Ctx) error {
+	c.Set("Tus-Resumable", tusVersion)
+	if c.Method() != fiber.MethodOptions && c.Get("Tus-Resumable") != tusVersion {
+		c.Set("Tus-Version", tusVersion)
+		return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{"error": "unsupported tus version"})
+	}
+	return c.Next()
+}
+
+func tusOptionsHandler(c *fiber.Ctx) error {
+	c.Set("Tus-Version", tusVersion)
+	c.Set("Tus-Extension", "creation")
+	c.Set("Tus-Max-Size", strconv.FormatInt(maxUploadBytes, 10))
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// tusCreateHandler starts an upload of Upload-Length bytes.
+func tusCreateHandler(c *fiber.Ctx) error {
+	length, err := strconv.ParseInt(c.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Upload-Length must be a non-negative integer"})
+	}
+	if length > maxUploadBytes {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fileTooLargeError())
+	}
+
+	// The metadata outlives the request, so it can't point into fiber's
+	// reused header buffer.
+	metadata, err := parseTusMetadata(utils.CopyString(c.Get("Upload-Metadata")))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if v, ok := metadata["cidVersion"]; ok {
+		if _, err := parseCIDVersion(v); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	spool, err := os.CreateTemp(spoolDir, "ipfs-tus-*")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	spool.Close()
+
+	id := uuid.NewString()
+	u := &tusUpload{path: spool.Name(), length: length, metadata: metadata}
+	u.expiry = time.AfterFunc(tusUploadExpiry, func() { removeTusUpload(id) })
+
+	tusMu.Lock()
+	tusUploads[id] = u
+	tusMu.Unlock()
+
+	c.Set(fiber.HeaderLocation, c.BaseURL()+"/files/"+id)
+	return c.SendStatus(fiber.StatusCreated)
+}
+
+// tusHeadHandler reports how much of an upload the server has.
+func tusHeadHandler(c *fiber.Ctx) error {
+	u := lookupTusUpload(c.Params("id"))
+	if u == nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set("Upload-Offset", strconv.FormatInt(u.offset, 10))
+	c.Set("Upload-Length", strconv.FormatInt(u.length, 10))
+	if u.result != nil {
+		c.Set("Upload-CID", u.result.CID)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// tusPatchHandler appends a chunk at Upload-Offset. The request completing
+// the upload also pins it; a zero-length PATCH at the end retries a pin
+// that failed.
+func tusPatchHandler(c *fiber.Ctx) error {
+	id := c.Params("id")
+	u := lookupTusUpload(id)
+	if u == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "unknown upload id"})
+	}
+	if c.Get(fiber.HeaderContentType) != "application/offset+octet-stream" {
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{"error": "Content-Type must be application/offset+octet-stream"})
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	offset, err := strconv.ParseInt(c.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset != u.offset {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Upload-Offset does not match the current offset"})
+	}
+
+	chunk := c.Body()
+	if u.offset+int64(len(chunk)) > u.length {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": "chunk exceeds Upload-Length"})
+	}
+	if len(chunk) > 0 {
+		if err := appendChunk(u.path, chunk); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		u.offset += int64(len(chunk))
+		u.expiry.Reset(tusUploadExpiry)
+	}
+	c.Set("Upload-Offset", strconv.FormatInt(u.offset, 10))
+
+	if u.offset < u.length {
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+	if u.result == nil {
+		release, err := acquireUploadSlot()
+		if err != nil {
+			return uploadSlotErrorResponse(c, err)
+		}
+		result, err := pinTusUpload(uploadContext(c), u)
+		release()
+		if err != nil {
+			var mediaErr *unsupportedMediaTypeError
+			if errors.As(err, &mediaErr) {
+				removeTusUpload(id)
+				return contentTypeErrorResponse(c, err)
+			}
+			return pinErrorResponse(c, fiber.StatusInternalServerError, err)
+		}
+		u.result = &result
+		// Keep the result around briefly for a client that re-checks
+		// with HEAD, then drop the assembled file.
+		u.expiry.Reset(progressRetention)
+	}
+
+	c.Set("Upload-CID", u.result.CID)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func appendChunk(path string, chunk []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(chunk); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// pinTusUpload pins the assembled file, honouring the filename, name and
+// cidVersion keys of Upload-Metadata.
+func pinTusUpload(ctx context.Context, u *tusUpload) (uploadResult, error) {
+	file, err := os.Open(u.path)
+	if err != nil {
+		return uploadResult{}, err
+	}
+	defer file.Close()
+
+	contentType, err := checkContentType(file)
+	if err != nil {
+		return uploadResult{}, err
+	}
+
+	opts := uploadOptions{cidVersion: cidVersion, metadata: pinata.Metadata{Name: u.metadata["name"]}}
+	if v, ok := u.metadata["cidVersion"]; ok {
+		n, _ := parseCIDVersion(v)
+		opts.cidVersion = &n
+	}
+
+	filename := u.metadata["filename"]
+	if filename == "" {
+		filename = "upload"
+	}
+	return uploadToIPFS(ctx, file, newFileHeader(filename, u.length, contentType), opts)
+}
+
+// parseTusMetadata decodes Upload-Metadata: comma-separated "key value"
+// pairs with base64-encoded values, where the value may be omitted.
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, errors.New("malformed Upload-Metadata")
+		}
+		var value []byte
+		if len(fields) == 2 {
+			var err error
+			if value, err = base64.StdEncoding.DecodeString(fields[1]); err != nil {
+				return nil, errors.New("malformed Upload-Metadata")
+			}
+		}
+		metadata[fields[0]] = string(value)
+	}
+	return metadata, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestTusPinWaitsForUploadSlot(t *testing.T) {
+	pinned := 0
+	useFakePinner(t, func(name string, content []byte) (string, error) {
+		pinned++
+		return testCID, nil
+	})
+	oldSlots, oldQueued := uploadSlots, maxQueuedUploads
+	uploadSlots, maxQueuedUploads = make(chan struct{}, 1), 0
+	t.Cleanup(func() { uploadSlots, maxQueuedUploads = oldSlots, oldQueued })
+	spoolDir = t.TempDir()
+	t.Cleanup(func() { spoolDir = "" })
+
+	app := fiber.New()
+	files := app.Group("/files", tusHeaders)
+	files.Post("", tusCreateHandler)
+	files.Patch("/:id", tusPatchHandler)
+	send := func(method, path string, headers map[string]string, body string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Tus-Resumable", tusVersion)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	content := "hello tus"
+	created := send("POST", "/files", map[string]string{
+		"Upload-Length":   strconv.Itoa(len(content)),
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("hello.txt")),
+	}, "")
+	if created.StatusCode != fiber.StatusCreated {
+		t.Fatalf("create status = %d", created.StatusCode)
+	}
+	location := created.Header.Get(fiber.HeaderLocation)
+	path := location[strings.Index(location, "/files/"):]
+	patch := func(offset int, body string) *http.Response {
+		return send("PATCH", path, map[string]string{
+			fiber.HeaderContentType: "application/offset+octet-stream",
+			"Upload-Offset":         strconv.Itoa(offset),
+		}, body)
+	}
+
+	uploadSlots <- struct{}{}
+	if resp := patch(0, content); resp.StatusCode != fiber.StatusServiceUnavailable {
+		t.Fatalf("with no free slot: status = %d, want %d", resp.StatusCode, fiber.StatusServiceUnavailable)
+	}
+	if pinned != 0 {
+		t.Fatalf("pinned %d times without a slot", pinned)
+	}
+
+	<-uploadSlots
+	resp := patch(len(content), "")
+	if resp.StatusCode != fiber.StatusNoContent || resp.Header.Get("Upload-CID") != testCID {
+		t.Fatalf("retry: status = %d, Upload-CID = %q", resp.StatusCode, resp.Header.Get("Upload-CID"))
+	}
+	if pinned != 1 || len(uploadSlots) != 0 {
+		t.Errorf("pinned = %d, slots held = %d; want 1 and 0", pinned, len(uploadSlots))
+	}
+}
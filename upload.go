@@ -0,0 +1,439 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/textproto"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"ipfs-fiber-uploader/pinata"
+)
+
+// pinataClient is shared by all Pinata calls and built from the environment
+// in loadEnv.
+var pinataClient = pinata.NewClient("", "")
+
+// uploadOptions carries the per-request settings of an upload.
+type uploadOptions struct {
+	metadata   pinata.Metadata
+	cidVersion *int
+	groupID    string
+	force      bool
+	private    bool
+	tenant     *pinata.Client // from X-Pinata-JWT
+}
+
+// uploadOptionsFromRequest reads the force query parameter, the
+// cidVersion (overriding CID_VERSION), group_id and private form fields or
+// query parameters, and the caller's X-Pinata-JWT.
+func uploadOptionsFromRequest(c *fiber.Ctx) (uploadOptions, error) {
+	opts := uploadOptions{
+		cidVersion: cidVersion,
+		force:      c.Query("force") == "true",
+		private:    c.FormValue("private") == "true",
+	}
+	tenant, err := tenantClient(c)
+	if err != nil {
+		return opts, err
+	}
+	opts.tenant = tenant
+	if v := c.FormValue("cidVersion"); v != "" {
+		n, err := parseCIDVersion(v)
+		if err != nil {
+			return opts, err
+		}
+		opts.cidVersion = &n
+	}
+	if v := c.FormValue("group_id"); v != "" {
+		if _, err := uuid.Parse(v); err != nil {
+			return opts, errors.New("group_id must be a Pinata group UUID")
+		}
+		opts.groupID = v
+	}
+	return opts, nil
+}
+
+// groupRejectedError is a Pinata rejection of the group_id a client asked
+// for, which is the client's mistake rather than the server's.
+type groupRejectedError struct {
+	groupID string
+	err     *pinata.APIError
+}
+
+func (e *groupRejectedError) Error() string {
+	return fmt.Sprintf("pinata rejected group_id %q: %v", e.groupID, e.err)
+}
+
+func (e *groupRejectedError) Unwrap() error { return e.err }
+
+// privateMetadata tags a private upload's pin with visibility=private. IPFS
+// content is public to anyone who has its CID: "private" only marks the pin
+// in Pinata and keeps the returned URL on the dedicated gateway.
+func privateMetadata(metadata pinata.Metadata) pinata.Metadata {
+	return withKeyValues(metadata, map[string]interface{}{"visibility": "private"})
+}
+
+// withKeyValues returns metadata with extra merged into a copy of its
+// keyvalues, leaving the caller's map untouched.
+func withKeyValues(metadata pinata.Metadata, extra map[string]interface{}) pinata.Metadata {
+	keyValues := make(map[string]interface{}, len(metadata.KeyValues)+len(extra))
+	for k, v := range metadata.KeyValues {
+		keyValues[k] = v
+	}
+	for k, v := range extra {
+		keyValues[k] = v
+	}
+	metadata.KeyValues = keyValues
+	return metadata
+}
+
+func parseCIDVersion(v string) (int, error) {
+	switch v {
+	case "0":
+		return 0, nil
+	case "1":
+		return 1, nil
+	}
+	return 0, errors.New("cidVersion must be 0 or 1")
+}
+
+// uploadToIPFS pins file through the configured storage backend, optionally
+// verifying the returned CID, and logs failures with the originating
+// request ID. Content already pinned under the same SHA-256 reuses its CID
+// without a round trip unless opts.force is set, or a group is requested,
+// since the earlier pin may not belong to it.
+func uploadToIPFS(ctx context.Context, file multipart.File, fileHeader *multipart.FileHeader, opts uploadOptions) (uploadResult, error) {
+	// A job cancelled while it waited for a worker stops here.
+	if err := ctx.Err(); err != nil {
+		return uploadResult{}, err
+	}
+	defer trackUpload(fileHeader.Filename)()
+	if fileHeader.Size == 0 {
+		return uploadResult{}, errEmptyFile
+	}
+
+	if stripEXIF {
+		var cleanup func()
+		var err error
+		file, fileHeader, cleanup, err = stripUploadMetadata(file, fileHeader)
+		if err != nil {
+			return uploadResult{}, err
+		}
+		defer cleanup()
+	}
+
+	if clamavAddress != "" {
+		if err := scanForViruses(ctx, io.NewSectionReader(file, 0, fileHeader.Size)); err != nil {
+			logEvent("error", "virus scan rejected upload", map[string]interface{}{
+				"request_id": requestIDFromContext(ctx),
+				"filename":   fileHeader.Filename,
+				"error":      err.Error(),
+			})
+			return uploadResult{}, err
+		}
+	}
+
+	sum, digests, n, err := fileDigests(file, fileHeader.Size)
+	if err != nil {
+		return uploadResult{}, err
+	}
+	// A header may claim bytes the file doesn't hold.
+	if n == 0 {
+		return uploadResult{}, errEmptyFile
+	}
+	if opts.metadata.Name == "" && pinNameTemplate != "" {
+		opts.metadata.Name = expandPinName(pinNameTemplate, fileHeader.Filename, sum, time.Now())
+	}
+
+	if opts.private {
+		opts.metadata = privateMetadata(opts.metadata)
+	}
+
+	// The pinned bytes may be a gzipped copy; everything reported back
+	// describes the original.
+	pinFile, pinHeader, originalType := file, fileHeader, ""
+	if compressBeforePin {
+		var cleanup func()
+		pinFile, pinHeader, originalType, cleanup, err = gzipUpload(file, fileHeader)
+		if err != nil {
+			return uploadResult{}, err
+		}
+		defer cleanup()
+		if originalType != "" {
+			opts.metadata = gzipMetadata(opts.metadata, originalType)
+		}
+	}
+	gzipped := originalType != ""
+
+	// A cached CID was pinned without this request's group or private tag,
+	// may hold the uncompressed bytes, and is on the server's account.
+	cid, cached := "", false
+	if !opts.force && opts.groupID == "" && !opts.private && !gzipped && opts.tenant == nil {
+		cid, cached = lookupDedup(ctx, sum, opts.cidVersion)
+	}
+	if !cached {
+		cid, err = pinFileToIPFS(ctx, pinFile, pinHeader, opts)
+		if err == nil && waitForPin {
+			if err = awaitPin(ctx, opts.pinChecker(), cid); err != nil {
+				err = fmt.Errorf("%w (cid %s)", err, cid)
+			}
+		}
+		if err != nil {
+			uploadFailuresTotal.Inc()
+			var apiErr *pinata.APIError
+			if errors.As(err, &apiErr) && apiErr.IsAuthError() && opts.tenant != nil {
+				err = &tenantAuthError{err: apiErr}
+			} else if apiErr != nil && apiErr.IsAuthError() {
+				warnPinataAuth(apiErr)
+			} else if apiErr != nil && opts.groupID != "" && apiErr.StatusCode >= 400 && apiErr.StatusCode < 500 && apiErr.StatusCode != fiber.StatusTooManyRequests {
+				err = &groupRejectedError{groupID: opts.groupID, err: apiErr}
+			}
+			requestID := requestIDFromContext(ctx)
+			logEvent("error", "upload failed", map[string]interface{}{
+				"request_id": requestID,
+				"provider":   storageProvider,
+				"filename":   fileHeader.Filename,
+				"error":      err.Error(),
+			})
+			if requestID != "" {
+				return uploadResult{}, fmt.Errorf("%w (request_id=%s)", err, requestID)
+			}
+			return uploadResult{}, err
+		}
+		switch {
+		case gzipped:
+			gzipPins.add(cid, originalType)
+		case opts.tenant == nil:
+			uploadDedup.add(dedupKey(sum, opts.cidVersion), cid)
+		}
+		if opts.tenant == nil {
+			pinStatuses.forget(cid)
+		}
+		uploadBytesTotal.Add(float64(pinHeader.Size))
+	}
+	uploadsTotal.Inc()
+
+	name := opts.metadata.Name
+	if name == "" {
+		name = fileHeader.Filename
+	}
+	rec := uploadRecord{
+		CID:         cid,
+		Filename:    fileHeader.Filename,
+		Size:        fileHeader.Size,
+		ContentType: fileHeader.Header.Get("Content-Type"),
+		Name:        name,
+		SHA256:      sum,
+		CreatedAt:   time.Now(),
+	}
+	if opts.tenant != nil {
+		// Keep a tenant's pins out of the index lookupDedup consults.
+		rec.SHA256 = ""
+	}
+	if err := recordUpload(context.Background(), rec); err != nil {
+		logEvent("error", "recording upload failed", map[string]interface{}{"cid": cid, "error": err.Error()})
+	}
+	notifyWebhook(webhookPayload{CID: cid, Filename: fileHeader.Filename, Size: fileHeader.Size, Timestamp: rec.CreatedAt.UTC()})
+
+	// Private uploads skip GATEWAY_BY_TYPE, whose routes are usually public
+	// CDNs, in favour of the token-authenticated dedicated gateway.
+	ipfsURL := gatewayURL(cid)
+	if !opts.private {
+		ipfsURL = uploadGatewayURL(cid, file)
+	}
+	result := uploadResult{
+		Filename:    fileHeader.Filename,
+		CID:         cid,
+		IpfsURL:     ipfsURL,
+		Size:        fileHeader.Size,
+		ContentType: rec.ContentType,
+		SHA256:      sum,
+		Hashes:      digests,
+		Cached:      cached,
+		PinStatus:   pinStatus(cached),
+		Private:     opts.private,
+	}
+	if gzipped {
+		result.ContentEncoding = "gzip"
+	}
+	return result, nil
+}
+
+// Sentinels for upload failures that map to their own HTTP status in
+// pinErrorResponse. Wrap them with %w to add detail.
+var (
+	errFileTooLarge = errors.New("file exceeds max size")
+	errEmptyFile    = errors.New("empty file")
+	errInvalidCID   = errors.New("invalid CID")
+)
+
+// dirUploadFile is one file of a directory upload, with its path relative
+// to the directory root.
+type dirUploadFile struct {
+	path string
+	size int64
+	open func() (multipart.File, error)
+}
+
+// uploadDirToIPFS pins files as a single directory named dirName, returning
+// the CID of the directory that wraps them. Every file passes the same size,
+// content type and virus checks as a single upload before anything is sent.
+func uploadDirToIPFS(ctx context.Context, dirName string, files []dirUploadFile, opts uploadOptions) (string, error) {
+	dirPinner := opts.directoryPinner()
+	if dirPinner == nil {
+		return "", errors.New("directory uploads require STORAGE_PROVIDER=pinata")
+	}
+
+	dirFiles := make([]pinata.DirFile, len(files))
+	var total int64
+	for i, f := range files {
+		if err := checkDirUploadFile(ctx, f); err != nil {
+			return "", fmt.Errorf("%s: %w", f.path, err)
+		}
+		open := f.open
+		dirFiles[i] = pinata.DirFile{
+			Path: f.path,
+			Open: func() (io.ReadCloser, error) { return open() },
+		}
+		total += f.size
+	}
+
+	if opts.private {
+		opts.metadata = privateMetadata(opts.metadata)
+	}
+	start := time.Now()
+	cid, err := dirPinner.PinDirectory(ctx, dirName, dirFiles, opts.metadata, pinata.Options{CIDVersion: opts.cidVersion, GroupID: opts.groupID})
+	pinDuration.WithLabelValues(storageProvider).Observe(time.Since(start).Seconds())
+	if err != nil {
+		uploadFailuresTotal.Inc()
+		var apiErr *pinata.APIError
+		if errors.As(err, &apiErr) && apiErr.IsAuthError() && opts.tenant != nil {
+			err = &tenantAuthError{err: apiErr}
+		} else if apiErr != nil && apiErr.IsAuthError() {
+			warnPinataAuth(apiErr)
+		}
+		logEvent("error", "directory upload failed", map[string]interface{}{
+			"request_id": requestIDFromContext(ctx),
+			"directory":  dirName,
+			"files":      len(files),
+			"error":      err.Error(),
+		})
+		return "", err
+	}
+	uploadsTotal.Inc()
+	uploadBytesTotal.Add(float64(total))
+	return cid, nil
+}
+
+func checkDirUploadFile(ctx context.Context, f dirUploadFile) error {
+	if f.size > maxUploadBytes {
+		return fmt.Errorf("%w of %d bytes", errFileTooLarge, maxUploadBytes)
+	}
+	file, err := f.open()
+	if err != nil {
+		return errors.New("File open failed")
+	}
+	defer file.Close()
+
+	if _, err := checkContentType(file); err != nil {
+		return err
+	}
+	if clamavAddress != "" {
+		return scanForViruses(ctx, io.NewSectionReader(file, 0, f.size))
+	}
+	return nil
+}
+
+// pinStatus is reported once WAIT_FOR_PIN has confirmed a new pin.
+func pinStatus(cached bool) string {
+	if waitForPin && !cached {
+		return "pinned"
+	}
+	return ""
+}
+
+// dryRunUpload computes the CIDv1 file would be stored under without
+// contacting the storage backend.
+func dryRunUpload(file multipart.File, fileHeader *multipart.FileHeader) (uploadResult, error) {
+	if stripEXIF {
+		var cleanup func()
+		var err error
+		file, fileHeader, cleanup, err = stripUploadMetadata(file, fileHeader)
+		if err != nil {
+			return uploadResult{}, err
+		}
+		defer cleanup()
+	}
+
+	cid, err := computeCIDVersion(file, 1)
+	if err != nil {
+		return uploadResult{}, err
+	}
+	return uploadResult{
+		Filename:    fileHeader.Filename,
+		CID:         cid,
+		IpfsURL:     uploadGatewayURL(cid, file),
+		Size:        fileHeader.Size,
+		ContentType: fileHeader.Header.Get("Content-Type"),
+		DryRun:      true,
+	}, nil
+}
+
+// newFileHeader describes content that didn't arrive as a multipart part,
+// so it can go through the same upload path.
+func newFileHeader(filename string, size int64, contentType string) *multipart.FileHeader {
+	return &multipart.FileHeader{
+		Filename: filename,
+		Size:     size,
+		Header:   textproto.MIMEHeader{"Content-Type": {contentType}},
+	}
+}
+
+func pinFileToIPFS(ctx context.Context, file multipart.File, fileHeader *multipart.FileHeader, opts uploadOptions) (string, error) {
+	var cid string
+	var err error
+	start := time.Now()
+	if opts.tenant != nil {
+		cid, err = opts.tenant.PinFile(ctx, file, fileHeader.Filename, opts.metadata, pinata.Options{CIDVersion: opts.cidVersion, GroupID: opts.groupID})
+	} else if p, ok := pinner.(metadataPinner); ok {
+		cid, err = p.PinWithMetadata(ctx, file, fileHeader.Filename, opts.metadata, pinata.Options{CIDVersion: opts.cidVersion, GroupID: opts.groupID})
+	} else {
+		cid, err = pinner.Pin(ctx, file, fileHeader.Filename)
+	}
+	pinDuration.WithLabelValues(storageProvider).Observe(time.Since(start).Seconds())
+	if err != nil {
+		return "", err
+	}
+
+	if verifyCID {
+		if err := verifyLocalCID(file, cid); err != nil {
+			return "", err
+		}
+	}
+	return cid, nil
+}
+
+// pinataAuthWarnInterval keeps a misconfigured server from flooding the log
+// while still repeating the warning until the keys are fixed.
+const pinataAuthWarnInterval = time.Minute
+
+var lastPinataAuthWarning int64 // unix nanoseconds, accessed atomically
+
+// warnPinataAuth logs loudly that Pinata rejected the server's own
+// credentials, at most once per pinataAuthWarnInterval.
+func warnPinataAuth(apiErr *pinata.APIError) {
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&lastPinataAuthWarning)
+	if now-last < int64(pinataAuthWarnInterval) || !atomic.CompareAndSwapInt64(&lastPinataAuthWarning, last, now) {
+		return
+	}
+	log.Printf("🚨 Pinata rejected the server's credentials (%s auth, status %d): check PINATA_JWT or PINATA_API_KEY/PINATA_SECRET_API_KEY", pinataClient.AuthMethod(), apiErr.StatusCode)
+}
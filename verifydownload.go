@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// verifyBufferLimit is the largest download held in memory and checked
+// before any of it is sent. Larger ones are checked as they stream.
+const verifyBufferLimit = 8 << 20
+
+// verifyDownload, from VERIFY_DOWNLOAD, makes the /cid/ proxy recompute the
+// CID of what the gateway sent, so a compromised or misconfigured gateway
+// can't serve other content under the requested CID. Like VERIFY_CID it
+// assumes the default `ipfs add` layout this server pins with.
+var verifyDownload bool
+
+var errDownloadMismatch = errors.New("content from the gateway does not match the CID")
+
+// verifiedTrailer is sent after a streamed download once it has verified.
+const verifiedTrailer = "X-IPFS-Verified"
+
+// verifyDownloadBody checks resp's body against cid. A body of up to
+// verifyBufferLimit is read and checked in full, and replaced by the
+// checked bytes. A larger one is replaced by a stream that hashes as it
+// goes, sends verifiedTrailer at the end and aborts the response on a
+// mismatch, because the status has long been sent by then.
+func verifyDownloadBody(c *fiber.Ctx, cid string, resp *http.Response) error {
+	buf, err := io.ReadAll(io.LimitReader(resp.Body, verifyBufferLimit+1))
+	if err != nil {
+		resp.Body.Close()
+		return err
+	}
+
+	if len(buf) <= verifyBufferLimit {
+		resp.Body.Close()
+		if err := checkDownloadCID(bytes.NewReader(buf), cid); err != nil {
+			return err
+		}
+		c.Set(verifiedTrailer, "true")
+		resp.Body = io.NopCloser(bytes.NewReader(buf))
+		resp.ContentLength = int64(len(buf))
+		resp.Header.Del(fiber.HeaderContentLength)
+		return nil
+	}
+
+	// The Ctx is released before the body streams; the fasthttp response
+	// it wraps lives until the body is written. Trailers only exist in
+	// chunked responses, so the length is dropped.
+	response := c.Response()
+	response.Header.SetTrailer(verifiedTrailer)
+	pr, pw := io.Pipe()
+	v := &verifyingBody{
+		requestID: requestIDFromContext(c.UserContext()),
+		cid:       cid,
+		verified:  func() { response.Header.Set(verifiedTrailer, "true") },
+		r:         io.TeeReader(io.MultiReader(bytes.NewReader(buf), resp.Body), pw),
+		body:      resp.Body,
+		pw:        pw,
+		done:      make(chan error, 1),
+	}
+	go func() {
+		err := checkDownloadCID(pr, cid)
+		pr.CloseWithError(err)
+		v.done <- err
+	}()
+	resp.Body = v
+	resp.ContentLength = -1
+	resp.Header.Del(fiber.HeaderContentLength)
+	return nil
+}
+
+func checkDownloadCID(r io.Reader, cid string) error {
+	got, err := computeCIDVersion(r, cidVersionOf(cid))
+	if err != nil {
+		return err
+	}
+	if got != cid {
+		return fmt.Errorf("%w: requested %s but received %s", errDownloadMismatch, cid, got)
+	}
+	return nil
+}
+
+// verifyingBody feeds a streamed download to checkDownloadCID running on
+// the other end of pw, and reports the verdict once the download ends.
+type verifyingBody struct {
+	requestID string
+	cid       string
+	verified  func()
+	r         io.Reader
+	body      io.Closer
+	pw        *io.PipeWriter
+	done      chan error
+	err       error
+	eof       bool
+}
+
+func (v *verifyingBody) Read(p []byte) (int, error) {
+	if v.eof {
+		return 0, v.readErr()
+	}
+	n, err := v.r.Read(p)
+	if err != io.EOF {
+		return n, err
+	}
+
+	v.eof = true
+	v.pw.Close()
+	v.err = <-v.done
+	if v.err != nil {
+		logEvent("error", "gateway content failed verification", map[string]interface{}{
+			"request_id": v.requestID,
+			"cid":        v.cid,
+			"error":      v.err.Error(),
+		})
+		// Failing the read makes fasthttp drop the connection before the
+		// final chunk, so the client sees an incomplete response.
+		return n, v.err
+	}
+	v.verified()
+	return n, io.EOF
+}
+
+func (v *verifyingBody) readErr() error {
+	if v.err != nil {
+		return v.err
+	}
+	return io.EOF
+}
+
+func (v *verifyingBody) Close() error {
+	if !v.eof {
+		v.pw.CloseWithError(errors.New("download ended before verification"))
+	}
+	return v.body.Close()
+}
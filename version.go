@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Build information, set at build time with
+//
+//	go build -ldflags "-X main.version=v1.2.3 -X main.commit=$(git rev-parse HEAD) -X main.buildTime=$(date -u +%FT%TZ)"
+//
+// commit falls back to the VCS revision Go embeds when building from a
+// checkout.
+var (
+	version   = "dev"
+	commit    = ""
+	buildTime = ""
+)
+
+func init() {
+	if commit != "" {
+		return
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" {
+				commit = s.Value
+			}
+		}
+	}
+}
+
+func versionString() string {
+	return fmt.Sprintf("%s (commit %s, built %s, %s)", version, orUnknown(commit), orUnknown(buildTime), runtime.Version())
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+func versionHandler(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"version":    version,
+		"commit":     orUnknown(commit),
+		"build_time": orUnknown(buildTime),
+		"go_version": runtime.Version(),
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	webhookTimeout    = 10 * time.Second
+	webhookMaxRetries = 3
+)
+
+// webhookURL, from WEBHOOK_URL, is notified after every successful pin.
+// With WEBHOOK_SECRET set, each delivery carries an X-Signature-256 header
+// of "sha256=" plus the hex HMAC-SHA256 of the body.
+var (
+	webhookURL    string
+	webhookSecret string
+	webhookClient = &http.Client{Timeout: webhookTimeout}
+)
+
+type webhookPayload struct {
+	CID       string    `json:"cid"`
+	Filename  string    `json:"filename"`
+	Size      int64     `json:"size"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// notifyWebhook delivers payload in the background so a slow or failing
+// receiver never delays or fails the upload itself.
+func notifyWebhook(payload webhookPayload) {
+	if webhookURL == "" {
+		return
+	}
+	go func() {
+		if err := deliverWebhook(payload); err != nil {
+			logEvent("error", "webhook delivery failed", map[string]interface{}{
+				"cid":   payload.CID,
+				"error": err.Error(),
+			})
+		}
+	}()
+}
+
+func deliverWebhook(payload webhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		err = postWebhook(body)
+		if err == nil || attempt >= webhookMaxRetries {
+			return err
+		}
+		time.Sleep(time.Duration(1<<attempt) * time.Second)
+	}
+}
+
+func postWebhook(body []byte) error {
+	req, err := http.NewRequest("POST", webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if webhookSecret != "" {
+		mac := hmac.New(sha256.New, []byte(webhookSecret))
+		mac.Write(body)
+		req.Header.Set("X-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
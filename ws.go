@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+
+	"ipfs-fiber-uploader/pinata"
+)
+
+// wsProgressStep is how many bytes arrive between progress messages.
+const wsProgressStep = 1 << 20
+
+// wsUploadRequest is the text frame that ends a /ws/upload stream.
+type wsUploadRequest struct {
+	Filename   string                 `json:"filename"`
+	Name       string                 `json:"name"`
+	KeyValues  map[string]interface{} `json:"keyvalues"`
+	CIDVersion *int                   `json:"cidVersion"`
+	Private    bool                   `json:"private"`
+}
+
+// requireWebSocket rejects plain HTTP requests to WebSocket endpoints.
+func requireWebSocket(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return c.Status(fiber.StatusUpgradeRequired).JSON(fiber.Map{"error": "this endpoint requires a WebSocket connection"})
+	}
+	return c.Next()
+}
+
+// wsUploadHandler assembles the binary frames of a WebSocket into a file,
+// reporting {"type":"progress","received":n} as data arrives. A final text
+// frame holding a wsUploadRequest pins the file, answered with a "done"
+// message carrying the upload result or an "error" message; the server
+// then closes the socket. A half-sent file is discarded when the client
+// disconnects.
+func wsUploadHandler(conn *websocket.Conn) {
+	sendError := func(msg string) {
+		conn.WriteJSON(fiber.Map{"type": "error", "error": msg})
+	}
+
+	// Every exit except a client disconnect follows a final message, so
+	// finish with a proper closing handshake.
+	disconnected := false
+	defer func() {
+		if !disconnected {
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		}
+	}()
+
+	spool, err := os.CreateTemp(uploadTmpDir, "ipfs-ws-*")
+	if err != nil {
+		sendError(err.Error())
+		return
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	conn.SetReadLimit(maxUploadBytes + 1<<20)
+	var received, reported int64
+	for {
+		msgType, data, err := conn.ReadMessage()
+		if err != nil {
+			// The client went away before finishing the upload.
+			disconnected = true
+			return
+		}
+
+		if msgType == websocket.BinaryMessage {
+			if received+int64(len(data)) > maxUploadBytes {
+				msg := fileTooLargeError()
+				msg["type"] = "error"
+				conn.WriteJSON(msg)
+				return
+			}
+			if _, err := spool.Write(data); err != nil {
+				sendError(err.Error())
+				return
+			}
+			received += int64(len(data))
+			if received-reported >= wsProgressStep {
+				reported = received
+				conn.WriteJSON(fiber.Map{"type": "progress", "received": received})
+			}
+			continue
+		}
+
+		var req wsUploadRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			sendError(`final text frame must be JSON like {"filename":"..."}`)
+			return
+		}
+		result, err := pinWSUpload(conn, spool, received, req)
+		if err != nil {
+			sendError(err.Error())
+			return
+		}
+		conn.WriteJSON(fiber.Map{"type": "done", "result": result})
+		return
+	}
+}
+
+func pinWSUpload(conn *websocket.Conn, spool *os.File, size int64, req wsUploadRequest) (uploadResult, error) {
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return uploadResult{}, err
+	}
+	contentType, err := checkContentType(spool)
+	if err != nil {
+		return uploadResult{}, err
+	}
+
+	opts := uploadOptions{
+		cidVersion: cidVersion,
+		metadata:   pinata.Metadata{Name: req.Name, KeyValues: req.KeyValues},
+		private:    req.Private,
+	}
+	if req.CIDVersion != nil {
+		n, err := parseCIDVersion(strconv.Itoa(*req.CIDVersion))
+		if err != nil {
+			return uploadResult{}, err
+		}
+		opts.cidVersion = &n
+	}
+
+	filename := req.Filename
+	if filename == "" {
+		filename = "upload"
+	}
+	release, err := acquireUploadSlot()
+	if err != nil {
+		return uploadResult{}, err
+	}
+	defer release()
+
+	requestID, _ := conn.Locals(requestIDKey).(string)
+	ctx := context.WithValue(uploadsCtx, requestIDKey, utils.CopyString(requestID))
+	return uploadToIPFS(ctx, spool, newFileHeader(filename, size, contentType), opts)
+}
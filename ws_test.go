@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net"
+	"testing"
+
+	wsclient "github.com/fasthttp/websocket"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+// wsUpload sends content over /ws/upload and returns the final message.
+func wsUpload(t *testing.T, addr, content string) map[string]interface{} {
+	t.Helper()
+	conn, _, err := wsclient.DefaultDialer.Dial("ws://"+addr+"/ws/upload", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.WriteMessage(wsclient.BinaryMessage, []byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteJSON(wsUploadRequest{Filename: "hello.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		var msg map[string]interface{}
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg["type"] != "progress" {
+			return msg
+		}
+	}
+}
+
+func TestWSUploadWaitsForUploadSlot(t *testing.T) {
+	pinned := 0
+	useFakePinner(t, func(name string, content []byte) (string, error) {
+		pinned++
+		return testCID, nil
+	})
+	oldSlots, oldQueued := uploadSlots, maxQueuedUploads
+	uploadSlots, maxQueuedUploads = make(chan struct{}, 1), 0
+	t.Cleanup(func() { uploadSlots, maxQueuedUploads = oldSlots, oldQueued })
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/ws/upload", requireWebSocket, websocket.New(wsUploadHandler))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(ln)
+	defer app.Shutdown()
+
+	uploadSlots <- struct{}{}
+	if msg := wsUpload(t, ln.Addr().String(), "hello"); msg["error"] != errUploadQueueFull.Error() || pinned != 0 {
+		t.Errorf("with no free slot: got %v after %d pins, want %q", msg, pinned, errUploadQueueFull)
+	}
+
+	<-uploadSlots
+	if msg := wsUpload(t, ln.Addr().String(), "hello"); msg["type"] != "done" || pinned != 1 {
+		t.Errorf("with a free slot: got %v after %d pins, want done", msg, pinned)
+	}
+	if len(uploadSlots) != 0 {
+		t.Errorf("%d slots still held after the upload", len(uploadSlots))
+	}
+}